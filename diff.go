@@ -0,0 +1,293 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Maximum number of differences reported by Diff.
+const maxDiffs = 64
+
+func Diff(a, b any) {
+	d := differ{visited: make(map[visit]bool)}
+	d.diff(nil, reflect.ValueOf(a), reflect.ValueOf(b))
+
+	out := make([]byte, 0, 256)
+	switch {
+	case d.n == 0:
+		out = append(out, "no differences"...)
+	case d.n == 1:
+		out = append(out, "1 difference"...)
+	default:
+		out = strconv.AppendInt(out, int64(d.n), 10)
+		out = append(out, " differences"...)
+	}
+	out = append(out, d.b...)
+	if d.n > maxDiffs {
+		out = fmt.Appendf(out, "\n  ... %d more", d.n-maxDiffs)
+	}
+
+	printf(0, nil, "%s", []any{string(out)})
+}
+
+// differ compares two values and collects their differences, one per line e.g.
+//
+//	.Items[3].Price: 10 -> 12
+//	.Tags["env"]: "dev" -> <missing>
+type differ struct {
+	b []byte
+	// Number of differences found
+	n int
+	// Pairs of pointers, maps and slices on the path to the current values, used to detect cycles.
+	visited map[visit]bool
+}
+
+// visit identifies a pair of pointers, maps or slices being compared.
+// Slices are identified by their data pointer and length.
+type visit struct {
+	a, b       uintptr
+	alen, blen int
+}
+
+// diff compares a and b located at path.
+func (d *differ) diff(path []byte, a, b reflect.Value) {
+	if !a.IsValid() || !b.IsValid() {
+		if a.IsValid() != b.IsValid() {
+			d.report(path, a, b)
+		}
+		return
+	}
+
+	if a.Type() != b.Type() {
+		d.report(path, a, b)
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Bool:
+		if a.Bool() != b.Bool() {
+			d.report(path, a, b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if a.Int() != b.Int() {
+			d.report(path, a, b)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if a.Uint() != b.Uint() {
+			d.report(path, a, b)
+		}
+	case reflect.Float32, reflect.Float64:
+		if fa, fb := a.Float(), b.Float(); fa != fb && !(math.IsNaN(fa) && math.IsNaN(fb)) {
+			d.report(path, a, b)
+		}
+	case reflect.Complex64, reflect.Complex128:
+		if a.Complex() != b.Complex() {
+			d.report(path, a, b)
+		}
+	case reflect.String:
+		if a.String() != b.String() {
+			d.report(path, a, b)
+		}
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		if a.Pointer() != b.Pointer() {
+			d.report(path, a, b)
+		}
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				d.report(path, a, b)
+			}
+			return
+		}
+		d.diff(path, a.Elem(), b.Elem())
+	case reflect.Pointer:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				d.report(path, a, b)
+			}
+			return
+		}
+		if a.Pointer() == b.Pointer() || !d.enter(a, b) {
+			return
+		}
+		defer d.leave(a, b)
+
+		d.diff(path, a.Elem(), b.Elem())
+	case reflect.Struct:
+		t := a.Type()
+		for i := 0; i < a.NumField(); i++ {
+			p := append(path[:len(path):len(path)], '.')
+			p = append(p, t.Field(i).Name...)
+			d.diff(p, a.Field(i), b.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		if a.Kind() == reflect.Slice && a.Len() > 0 && b.Len() > 0 {
+			if (a.Pointer() == b.Pointer() && a.Len() == b.Len()) || !d.enter(a, b) {
+				return
+			}
+			defer d.leave(a, b)
+		}
+
+		// nil and empty slices are considered equal.
+		n := max(a.Len(), b.Len())
+		for i := 0; i < n; i++ {
+			p := append(path[:len(path):len(path)], '[')
+			p = strconv.AppendInt(p, int64(i), 10)
+			p = append(p, ']')
+
+			switch {
+			case i >= a.Len():
+				d.report(p, reflect.Value{}, b.Index(i))
+			case i >= b.Len():
+				d.report(p, a.Index(i), reflect.Value{})
+			default:
+				d.diff(p, a.Index(i), b.Index(i))
+			}
+		}
+	case reflect.Map:
+		if a.Pointer() == b.Pointer() || !d.enter(a, b) {
+			return
+		}
+		defer d.leave(a, b)
+
+		d.diffMaps(path, a, b)
+	}
+}
+
+// diffMaps pairs the entries of a and b by their actual keys.
+// Printed keys only order the entries; distinct keys may print the same, e.g. 1 and int64(1) in a map[any]T.
+func (d *differ) diffMaps(path []byte, a, b reflect.Value) {
+	type entry struct {
+		key  string
+		typ  string
+		a, b reflect.Value
+	}
+	entries := make([]entry, 0, max(a.Len(), b.Len()))
+	iter := a.MapRange()
+	for iter.Next() {
+		k := iter.Key()
+		entries = append(entries, entry{key: dumpKey(k), typ: keyType(k), a: iter.Value(), b: b.MapIndex(k)})
+	}
+	iter = b.MapRange()
+	for iter.Next() {
+		if k := iter.Key(); !a.MapIndex(k).IsValid() {
+			entries = append(entries, entry{key: dumpKey(k), typ: keyType(k), b: iter.Value()})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].key != entries[j].key {
+			return entries[i].key < entries[j].key
+		}
+		return entries[i].typ < entries[j].typ
+	})
+
+	for _, e := range entries {
+		p := append(path[:len(path):len(path)], '[')
+		p = append(p, e.key...)
+		p = append(p, ']')
+
+		if !e.a.IsValid() || !e.b.IsValid() {
+			d.report(p, e.a, e.b)
+			continue
+		}
+		d.diff(p, e.a, e.b)
+	}
+}
+
+// keyType returns the dynamic type of the map key k.
+// It tells apart keys of interface maps that print the same.
+func keyType(k reflect.Value) string {
+	if k.Kind() == reflect.Interface && !k.IsNil() {
+		k = k.Elem()
+	}
+	return k.Type().String()
+}
+
+// enter marks the pair of pointers, maps or slices a, b as being compared.
+// It returns false if the pair is already being compared further up the path, i.e. the values are cyclic.
+func (d *differ) enter(a, b reflect.Value) bool {
+	k := visitOf(a, b)
+	if d.visited[k] {
+		return false
+	}
+	d.visited[k] = true
+	return true
+}
+
+func (d *differ) leave(a, b reflect.Value) {
+	delete(d.visited, visitOf(a, b))
+}
+
+func visitOf(a, b reflect.Value) visit {
+	k := visit{a: a.Pointer(), b: b.Pointer()}
+	if a.Kind() == reflect.Slice {
+		k.alen, k.blen = a.Len(), b.Len()
+	}
+	return k
+}
+
+// report adds a line for a difference at path.
+// Invalid values denote a missing element.
+func (d *differ) report(path []byte, a, b reflect.Value) {
+	d.n++
+	if d.n > maxDiffs {
+		return
+	}
+
+	d.b = append(d.b, "\n  "...)
+	if len(path) > 0 {
+		d.b = append(d.b, path...)
+		d.b = append(d.b, ": "...)
+	}
+
+	typed := a.IsValid() && b.IsValid() && a.Type() != b.Type()
+	d.b = appendDiffValue(d.b, a, typed)
+	d.b = append(d.b, " -> "...)
+	d.b = appendDiffValue(d.b, b, typed)
+}
+
+// appendDiffValue appends a short, single line representation of v.
+// Composite values are abbreviated. If typed is set, the type of v is prepended.
+func appendDiffValue(b []byte, v reflect.Value, typed bool) []byte {
+	if !v.IsValid() {
+		return append(b, "<missing>"...)
+	}
+	if typed {
+		b = append(b, '(')
+		b = append(b, v.Type().String()...)
+		b = append(b, ") "...)
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return append(b, "nil"...)
+		}
+		return appendDiffValue(b, v.Elem(), false)
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return append(b, "nil"...)
+		}
+		if v.Kind() == reflect.Pointer {
+			b = append(b, '&')
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Struct || v.Kind() == reflect.Map || v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			b = append(b, v.Type().String()...)
+			return append(b, "{...}"...)
+		}
+		return appendDiffValue(b, v, false)
+	case reflect.Struct, reflect.Array:
+		b = append(b, v.Type().String()...)
+		return append(b, "{...}"...)
+	default:
+		d := dumper{}
+		return d.contents(b, v, 0)
+	}
+}
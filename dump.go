@@ -0,0 +1,252 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Limits of Dump output.
+const (
+	// Maximum nesting depth; deeper values are shown as {...}
+	maxDumpDepth = 8
+	// Maximum number of elements shown per slice, array or map
+	maxDumpItems = 64
+	// Maximum number of bytes shown per string
+	maxDumpString = 256
+)
+
+func Dump(v ...any) {
+	b := make([]byte, 0, 256)
+	for i, val := range v {
+		if i > 0 {
+			b = append(b, '\n')
+		}
+		d := dumper{visited: make(map[uintptr]bool)}
+		b = d.value(b, reflect.ValueOf(val), 0)
+	}
+
+	printf(0, nil, "%s", []any{string(b)})
+}
+
+// dumper renders values as an indented, type-annotated tree e.g.
+//
+//	*main.Config &{
+//	  Name: string "api"
+//	  Ports: []int len=2 {
+//	    0: int 80
+//	    1: int 443
+//	  }
+//	  Parent: *main.Config <cycle>
+//	  err: error(*errors.errorString) &{
+//	    s: string "boom"
+//	  }
+//	}
+type dumper struct {
+	// Pointers and maps on the path to the current value, used to detect cycles.
+	visited map[uintptr]bool
+}
+
+// value appends the type of v followed by its contents.
+func (d *dumper) value(b []byte, v reflect.Value, depth int) []byte {
+	if !v.IsValid() {
+		return append(b, "nil"...)
+	}
+
+	b = append(b, v.Type().String()...)
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return append(b, " nil"...)
+		}
+		// Dynamic type e.g. error(*errors.errorString)
+		v = v.Elem()
+		b = append(b, '(')
+		b = append(b, v.Type().String()...)
+		b = append(b, ')')
+	}
+
+	b = append(b, ' ')
+	return d.contents(b, v, depth)
+}
+
+// contents appends the contents of v without its type.
+func (d *dumper) contents(b []byte, v reflect.Value, depth int) []byte {
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.AppendBool(b, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(b, v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.AppendUint(b, v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(b, v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Complex64, reflect.Complex128:
+		return fmt.Appendf(b, "%v", v.Complex())
+	case reflect.String:
+		return appendDumpString(b, v.String())
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		if v.IsNil() {
+			return append(b, "nil"...)
+		}
+		return fmt.Appendf(b, "%#x", v.Pointer())
+	case reflect.Interface:
+		if v.IsNil() {
+			return append(b, "nil"...)
+		}
+		return d.value(b, v.Elem(), depth)
+	case reflect.Pointer:
+		if v.IsNil() {
+			return append(b, "nil"...)
+		}
+		if d.visited[v.Pointer()] {
+			return append(b, "<cycle>"...)
+		}
+		d.visited[v.Pointer()] = true
+		defer delete(d.visited, v.Pointer())
+
+		b = append(b, '&')
+		return d.contents(b, v.Elem(), depth)
+	case reflect.Struct:
+		return d.structFields(b, v, depth)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return append(b, "nil"...)
+		}
+		return d.elements(b, v, depth)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, "nil"...)
+		}
+		if d.visited[v.Pointer()] {
+			return append(b, "<cycle>"...)
+		}
+		d.visited[v.Pointer()] = true
+		defer delete(d.visited, v.Pointer())
+
+		return d.mapEntries(b, v, depth)
+	default:
+		return fmt.Appendf(b, "%v", v)
+	}
+}
+
+func (d *dumper) structFields(b []byte, v reflect.Value, depth int) []byte {
+	if v.NumField() == 0 {
+		return append(b, "{}"...)
+	}
+	if depth >= maxDumpDepth {
+		return append(b, "{...}"...)
+	}
+
+	b = append(b, '{')
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		b = appendIndent(b, depth+1)
+		b = append(b, t.Field(i).Name...)
+		b = append(b, ": "...)
+		// Unexported fields can't be turned into interfaces but reflect still reads them.
+		b = d.value(b, v.Field(i), depth+1)
+	}
+	b = appendIndent(b, depth)
+	return append(b, '}')
+}
+
+func (d *dumper) elements(b []byte, v reflect.Value, depth int) []byte {
+	b = append(b, "len="...)
+	b = strconv.AppendInt(b, int64(v.Len()), 10)
+	if v.Len() == 0 {
+		return append(b, " {}"...)
+	}
+	if depth >= maxDumpDepth {
+		return append(b, " {...}"...)
+	}
+
+	b = append(b, " {"...)
+	for i := 0; i < v.Len(); i++ {
+		if i == maxDumpItems {
+			b = appendIndent(b, depth+1)
+			b = fmt.Appendf(b, "... %d more", v.Len()-i)
+			break
+		}
+		b = appendIndent(b, depth+1)
+		b = strconv.AppendInt(b, int64(i), 10)
+		b = append(b, ": "...)
+		b = d.value(b, v.Index(i), depth+1)
+	}
+	b = appendIndent(b, depth)
+	return append(b, '}')
+}
+
+func (d *dumper) mapEntries(b []byte, v reflect.Value, depth int) []byte {
+	b = append(b, "len="...)
+	b = strconv.AppendInt(b, int64(v.Len()), 10)
+	if v.Len() == 0 {
+		return append(b, " {}"...)
+	}
+	if depth >= maxDumpDepth {
+		return append(b, " {...}"...)
+	}
+
+	// Sort entries by their formatted key to get a stable output.
+	type entry struct {
+		key string
+		val reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		entries = append(entries, entry{key: dumpKey(iter.Key()), val: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	b = append(b, " {"...)
+	for i, e := range entries {
+		if i == maxDumpItems {
+			b = appendIndent(b, depth+1)
+			b = fmt.Appendf(b, "... %d more", len(entries)-i)
+			break
+		}
+		b = appendIndent(b, depth+1)
+		b = append(b, e.key...)
+		b = append(b, ": "...)
+		b = d.value(b, e.val, depth+1)
+	}
+	b = appendIndent(b, depth)
+	return append(b, '}')
+}
+
+// dumpKey formats a map key on a single line.
+func dumpKey(k reflect.Value) string {
+	for k.Kind() == reflect.Interface && !k.IsNil() {
+		k = k.Elem()
+	}
+	if k.Kind() == reflect.String {
+		return string(appendDumpString(nil, k.String()))
+	}
+	if k.CanInterface() {
+		return fmt.Sprintf("%v", k.Interface())
+	}
+	return fmt.Sprintf("%v", k)
+}
+
+// appendDumpString appends s quoted, truncated to maxDumpString bytes.
+func appendDumpString(b []byte, s string) []byte {
+	if len(s) <= maxDumpString {
+		return strconv.AppendQuote(b, s)
+	}
+	b = strconv.AppendQuote(b, s[:maxDumpString])
+	return fmt.Appendf(b, "... (%d bytes)", len(s))
+}
+
+// appendIndent starts a new line indented by depth levels.
+func appendIndent(b []byte, depth int) []byte {
+	b = append(b, '\n')
+	for i := 0; i < depth; i++ {
+		b = append(b, "  "...)
+	}
+	return b
+}
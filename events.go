@@ -0,0 +1,72 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"time"
+)
+
+// Print a line whenever a region is entered or exited.
+// Set by DLG_REGION_EVENTS.
+var regionEvents = false
+
+// regionEntered writes an event line announcing that region c was entered e.g.
+//
+//	12:00:01 [3µs] >> region "db" entered at repo.go:12
+func regionEntered(c *caller) {
+	if !regionEvents {
+		return
+	}
+
+	b := bufPool.Get().([]byte)
+
+	timestamp(&b)
+	b = append(b, ">> region "...)
+	b = appendRegionName(b, c)
+	b = append(b, "entered at "...)
+	b = append(b, baseName(c.file)...)
+	b = append(b, ':')
+	pad(&b, c.line, -1)
+	b = append(b, '\n')
+
+	writeEvent(b)
+}
+
+// regionExited writes an event line announcing that region c was exited e.g.
+//
+//	12:00:01 [4.2ms] << region "db" exited after 4.2ms
+func regionExited(c *caller) {
+	if !regionEvents {
+		return
+	}
+
+	b := bufPool.Get().([]byte)
+
+	timestamp(&b)
+	b = append(b, "<< region "...)
+	b = appendRegionName(b, c)
+	b = append(b, "exited after "...)
+	b = append(b, time.Since(c.start).String()...)
+	b = append(b, '\n')
+
+	writeEvent(b)
+}
+
+// appendRegionName appends the quoted name of c followed by a space.
+// Nothing is appended for unnamed regions.
+func appendRegionName(b []byte, c *caller) []byte {
+	if c.name == "" {
+		return b
+	}
+	b = append(b, '"')
+	b = append(b, c.name...)
+	return append(b, `" `...)
+}
+
+// writeEvent writes b to the output and returns it to the buffer pool.
+func writeEvent(b []byte) {
+	writeOut := writeOutput.Load().(writeOutputFn)
+	writeOut(b)
+
+	bufPool.Put(b[:0])
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vvvvv/dlg"
+)
+
+// expensiveReport stands in for an expensive computation that's only needed for debugging.
+//
+//go:noinline
+func expensiveReport() string {
+	return strings.Repeat("expensive ", 3)
+}
+
+func main() {
+	fmt.Println("hello world")
+
+	// expensiveReport is called in every build, even though dlg.Printf is eliminated.
+	// dlg.Printf("eager: %s", expensiveReport())
+
+	// expensiveReport is only called in builds with the dlg tag.
+	dlg.Printf("lazy: %s", dlg.Lazy(expensiveReport))
+}
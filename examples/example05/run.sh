@@ -0,0 +1,15 @@
+#!/usr/bin/env bash
+
+rm -f ./example05.bin
+rm -f ./example05.dlg.bin
+rm -f ./example05.objdump
+rm -f ./example05.dlg.objdump
+
+go build -o example05.bin
+go build -tags dlg -o example05.dlg.bin
+
+go tool objdump -S example05.bin >example05.objdump
+go tool objdump -S example05.dlg.bin >example05.dlg.objdump
+
+printf 'Lines containing "expensiveReport" in disassembly (no build tag): %5d    (see: %s)\n' "$(grep 'expensiveReport' ./example05.objdump | grep -v '^TEXT' | wc -l)" 'example05.objdump'
+printf 'Lines containing "expensiveReport" in disassembly (dlg build tag): %5d   (see: %s)\n' "$(grep 'expensiveReport' ./example05.dlg.objdump | grep -v '^TEXT' | wc -l)" 'example05.dlg.objdump'
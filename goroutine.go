@@ -0,0 +1,109 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+)
+
+// maxAncestors is the maximum number of ancestor goroutines tracked per goroutine.
+const maxAncestors = 8
+
+// Buffers for runtime.Stack
+var goroutineBufPool = sync.Pool{
+	New: func() any { return make([]byte, 4096) },
+}
+
+// goroutineInfo identifies a goroutine and the goroutines it was (transitively) spawned by.
+type goroutineInfo struct {
+	id        uint64
+	ancestors [maxAncestors]uint64
+	n         int
+}
+
+// descendsFrom reports whether the goroutine was spawned by the goroutine with the given id.
+func (g *goroutineInfo) descendsFrom(id uint64) bool {
+	for i := 0; i < g.n; i++ {
+		if g.ancestors[i] == id {
+			return true
+		}
+	}
+	return false
+}
+
+// currentGoroutine returns the id and ancestors of the calling goroutine.
+//
+// The Go runtime doesn't expose goroutine ids so they are parsed from the output of runtime.Stack:
+//
+//	goroutine 7 [running]:
+//	...
+//	created by main.main in goroutine 1
+//
+// By default only the direct parent is known.
+// With GODEBUG=tracebackancestors=N the runtime additionally reports up to N ancestors
+// ("[originating from goroutine N]:") which are picked up as well.
+func currentGoroutine() (g goroutineInfo) {
+	buf := goroutineBufPool.Get().([]byte)
+
+	n := runtime.Stack(buf, false)
+	for n == len(buf) && len(buf) < (1<<20) {
+		// Stack got truncated; the "created by" line is at the very end so we need all of it.
+		buf = make([]byte, len(buf)*2)
+		n = runtime.Stack(buf, false)
+	}
+	stack := buf[:n]
+
+	g.id, _ = parseGoroutineID(stack, "goroutine ")
+
+	const (
+		createdBy   = "created by "
+		inGoroutine = " in goroutine "
+		originating = "[originating from goroutine "
+	)
+
+	for len(stack) > 0 && g.n < maxAncestors {
+		line := stack
+		if i := bytes.IndexByte(stack, '\n'); i >= 0 {
+			line, stack = stack[:i], stack[i+1:]
+		} else {
+			stack = nil
+		}
+
+		if bytes.HasPrefix(line, []byte(createdBy)) {
+			if idx := bytes.LastIndex(line, []byte(inGoroutine)); idx >= 0 {
+				if id, ok := parseGoroutineID(line[idx:], inGoroutine); ok {
+					g.ancestors[g.n] = id
+					g.n++
+				}
+			}
+		} else if bytes.HasPrefix(line, []byte(originating)) {
+			if id, ok := parseGoroutineID(line, originating); ok {
+				g.ancestors[g.n] = id
+				g.n++
+			}
+		}
+	}
+
+	if cap(buf) <= (1 << 15) {
+		goroutineBufPool.Put(buf[:cap(buf)])
+	}
+
+	return g
+}
+
+// parseGoroutineID parses the decimal number following prefix in b.
+func parseGoroutineID(b []byte, prefix string) (id uint64, ok bool) {
+	if !bytes.HasPrefix(b, []byte(prefix)) {
+		return 0, false
+	}
+	for _, c := range b[len(prefix):] {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + uint64(c-'0')
+		ok = true
+	}
+	return id, ok
+}
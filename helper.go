@@ -0,0 +1,95 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Functions marked by Helper are skipped when reporting the callsite and stack trace of Printf.
+var (
+	hasHelpers atomic.Bool
+	helperMu   sync.Mutex
+	// Return PCs Helper got called from (map[uintptr]struct{}).
+	// Calling Helper again from the same place only needs a lookup.
+	helperPCs atomic.Value
+	// Names of helper functions (map[string]struct{}).
+	helperFuncs atomic.Value
+)
+
+func Helper() {
+	var pc [1]uintptr
+	if runtime.Callers(2, pc[:]) == 0 {
+		return
+	}
+
+	if pcs, ok := helperPCs.Load().(map[uintptr]struct{}); ok {
+		if _, ok := pcs[pc[0]]; ok {
+			return
+		}
+	}
+
+	frame, _ := runtime.CallersFrames(pc[:]).Next()
+	if frame.Function == "" {
+		return
+	}
+
+	helperMu.Lock()
+	defer helperMu.Unlock()
+
+	pcs, _ := helperPCs.Load().(map[uintptr]struct{})
+	newPCs := make(map[uintptr]struct{}, len(pcs)+1)
+	for p := range pcs {
+		newPCs[p] = struct{}{}
+	}
+	newPCs[pc[0]] = struct{}{}
+
+	funcs, _ := helperFuncs.Load().(map[string]struct{})
+	newFuncs := make(map[string]struct{}, len(funcs)+1)
+	for f := range funcs {
+		newFuncs[f] = struct{}{}
+	}
+	newFuncs[frame.Function] = struct{}{}
+
+	helperFuncs.Store(newFuncs)
+	helperPCs.Store(newPCs)
+	hasHelpers.Store(true)
+}
+
+// isHelper reports whether the function fn was marked by Helper.
+func isHelper(fn string) bool {
+	funcs, _ := helperFuncs.Load().(map[string]struct{})
+	_, ok := funcs[fn]
+	return ok
+}
+
+// callerFrame returns the first frame runtime.Callers(skip) reports for the caller of callerFrame.
+// Frames of functions marked by Helper are skipped.
+func callerFrame(skip int) (frame runtime.Frame, ok bool) {
+	if !hasHelpers.Load() {
+		var pc [1]uintptr
+		if runtime.Callers(skip+1, pc[:]) == 0 {
+			return frame, false
+		}
+		frame, _ = runtime.CallersFrames(pc[:]).Next()
+		return frame, true
+	}
+
+	pcsp := pcPool.Get().(*[]uintptr)
+	defer pcPool.Put(pcsp)
+
+	n := runtime.Callers(skip+1, *pcsp)
+	if n == 0 {
+		return frame, false
+	}
+
+	frames := runtime.CallersFrames((*pcsp)[:n])
+	for {
+		f, more := frames.Next()
+		if !more || !isHelper(f.Function) {
+			return f, true
+		}
+	}
+}
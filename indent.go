@@ -0,0 +1,59 @@
+//go:build dlg
+
+package dlg
+
+// Indentation styles for Printf lines inside tracing regions.
+const (
+	indentNone = iota
+	// Two spaces per enclosing region
+	indentSpaces
+	// Tree drawn with box-drawing characters
+	indentTree
+)
+
+// Indent Printf lines by the number of enclosing regions.
+// Set by DLG_REGION_INDENT.
+var regionIndent = indentNone
+
+// parseRegionIndent returns the indentation style for the DLG_REGION_INDENT value v.
+// "tree" draws a tree, any other enabled value indents with spaces.
+func parseRegionIndent(v string, ok bool) int {
+	switch {
+	case v == "tree":
+		return indentTree
+	case enabled(v, ok):
+		return indentSpaces
+	default:
+		return indentNone
+	}
+}
+
+// indent appends the indentation for a Printf line enclosed by regions e.g.
+//
+//	12:00:01 [3µs] handler.go:40: request
+//	12:00:01 [9µs]   repo.go:12: query
+//	12:00:01 [2ms]     tx.go:30: commit
+//
+// or with indentTree
+//
+//	12:00:01 [3µs] handler.go:40: request
+//	12:00:01 [9µs] ├─ repo.go:12: query
+//	12:00:01 [2ms] │  ├─ tx.go:30: commit
+func indent(buf *[]byte, regions []*caller) {
+	depth := len(regions)
+	if depth == 0 {
+		return
+	}
+
+	switch regionIndent {
+	case indentSpaces:
+		for i := 0; i < depth; i++ {
+			*buf = append(*buf, "  "...)
+		}
+	case indentTree:
+		for i := 1; i < depth; i++ {
+			*buf = append(*buf, "│  "...)
+		}
+		*buf = append(*buf, "├─ "...)
+	}
+}
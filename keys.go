@@ -0,0 +1,97 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"reflect"
+	"runtime"
+)
+
+// keyPair chains the values of a key made up of more than one value.
+// It is comparable as long as head and tail are.
+type keyPair struct {
+	head any
+	tail any
+}
+
+// Open keyed regions by key, oldest first.
+// Guarded by callersMu.
+var keyedRegions = make(map[any][]*caller)
+
+// regionKey turns the values passed to StartTrace or StopTrace into a single comparable map key.
+// ok is false if any of the values isn't comparable e.g. a slice, a map or a func.
+func regionKey(key []any) (k any, ok bool) {
+	for _, v := range key {
+		if v != nil && !reflect.ValueOf(v).Comparable() {
+			return nil, false
+		}
+	}
+
+	k = key[len(key)-1]
+	for i := len(key) - 2; i >= 0; i-- {
+		k = keyPair{head: key[i], tail: k}
+	}
+	return k, true
+}
+
+// addKeyedRegion registers the keyed region c.
+// callersMu must be held.
+func addKeyedRegion(c *caller) {
+	keyedRegions[c.hkey] = append(keyedRegions[c.hkey], c)
+}
+
+// removeKeyedRegion unregisters the keyed region c.
+// callersMu must be held.
+func removeKeyedRegion(c *caller) {
+	regions := keyedRegions[c.hkey]
+	for i := len(regions) - 1; i >= 0; i-- {
+		if regions[i] != c {
+			continue
+		}
+
+		if len(regions) == 1 {
+			delete(keyedRegions, c.hkey)
+		} else {
+			keyedRegions[c.hkey] = deleteItemAt(regions, i)
+		}
+		return
+	}
+}
+
+// lastKeyedRegion returns the most recently started open region with the key k, or nil.
+// callersMu must be held.
+func lastKeyedRegion(k any) *caller {
+	regions := keyedRegions[k]
+	if len(regions) == 0 {
+		return nil
+	}
+	return regions[len(regions)-1]
+}
+
+// invalidKey reports that fn got called with the non-comparable key.
+// In strict mode this panics via misuse, otherwise a diagnostic is written to the output e.g.
+//
+//	12:00:01 [3µs] dlg: StartTrace([]int{1, 2}) ignored, key is not comparable (called at handler.go:40)
+//
+// skip is the number of stack frames to ascend to the offending call, with 1 identifying the caller of invalidKey.
+func invalidKey(skip int, fn string, key []any) {
+	misuse(skip+1, "%s%s called with a key that is not comparable", fn, formatKey(key))
+
+	b := bufPool.Get().([]byte)
+
+	timestamp(&b)
+	b = append(b, "dlg: "...)
+	b = append(b, fn...)
+	b = append(b, formatKey(key)...)
+	b = append(b, " ignored, key is not comparable"...)
+	if _, file, line, ok := runtime.Caller(skip); ok {
+		b = append(b, " (called at "...)
+		b = append(b, baseName(file)...)
+		b = append(b, ':')
+		pad(&b, line, -1)
+		b = append(b, ')')
+	}
+	b = append(b, '\n')
+
+	writeEvent(b)
+}
@@ -0,0 +1,20 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"fmt"
+)
+
+// lazyValue defers calling fn until the argument gets formatted.
+type lazyValue[T any] struct {
+	fn func() T
+}
+
+func (l lazyValue[T]) Format(f fmt.State, verb rune) {
+	fmt.Fprintf(f, fmt.FormatString(f, verb), l.fn())
+}
+
+func Lazy[T any](fn func() T) any {
+	return lazyValue[T]{fn: fn}
+}
@@ -3,9 +3,23 @@
 package dlg
 
 import (
+	"context"
 	"io"
+	"time"
 )
 
+/*
+Enabled reports whether the program was built with the dlg build tag.
+As a constant it allows guarding debug-only code which the compiler removes entirely in builds without the tag:
+
+	if dlg.Enabled {
+		dlg.Printf("cache: %v", cache.Stats())
+	}
+
+In builds without the dlg tag, Enabled is false.
+*/
+const Enabled = false
+
 /*
 Printf writes a formatted message to standard error when built with the dlg build tag. Formatting uses the same verbs as fmt (see https://pkg.go.dev/fmt#hdr-Printing).
 It also supports optional stack trace generation, configurable at runtime via environment variables.
@@ -14,6 +28,50 @@ In builds without the dlg tag, Printf is a no-op.
 */
 func Printf(fmt string, v ...any) {}
 
+/*
+PrintfContext is like Printf but additionally considers the tracing region carried by ctx.
+If ctx was derived from a context returned by WithTrace, the call is treated as being inside
+a tracing region, regardless of the goroutine or call stack it is made from.
+
+In builds without the dlg tag, PrintfContext is a no-op.
+*/
+func PrintfContext(ctx context.Context, fmt string, v ...any) {}
+
+/*
+PrintfDepth is like Printf but skips skip additional stack frames when reporting the callsite
+and stack trace. PrintfDepth(0, ...) is equivalent to Printf; wrappers around it pass 1 to report
+the callsite of their caller instead of their own. A negative skip is treated as 0.
+
+In builds without the dlg tag, PrintfDepth is a no-op.
+*/
+func PrintfDepth(skip int, fmt string, v ...any) {}
+
+/*
+Do calls fn in builds with the dlg build tag. It's a shorthand for guarding a block with Enabled.
+
+	dlg.Do(func() {
+		stats := cache.Stats()
+		dlg.Printf("hits: %d misses: %d", stats.Hits, stats.Misses)
+	})
+
+In builds without the dlg tag, Do is a no-op and fn is never called.
+*/
+func Do(fn func()) {}
+
+/*
+Helper marks the calling function as a helper, similar to testing.T.Helper.
+Helper functions are skipped when Printf reports its callsite and stack trace, so a wrapper
+around Printf reports the file and line of the code calling the wrapper.
+
+	func logf(format string, v ...any) {
+		dlg.Helper()
+		dlg.Printf(format, v...)
+	}
+
+In builds without the dlg tag, Helper is a no-op.
+*/
+func Helper() {}
+
 /*
 SetOutput sets the output destination for Printf.
 While Printf itself is safe for concurrent use, this guarantee does not extend to custom writers.
@@ -34,7 +92,9 @@ will always include a stack trace. When set to "REGION,ERROR", only Printf calls
 region that include an error argument will include a stack trace.
 
 A tracing region can be started with an optional key (any comparable value). If a key is
-provided, only a matching StopTrace call with the same key will end that region. Without a key,
+provided, only a matching StopTrace call with the same key will end that region.
+Keys that aren't comparable, such as slices or maps, are rejected: the call is ignored and a
+diagnostic is written to the output. With DLG_STRICT=1 it panics instead. Without a key,
 StopTrace ends the most recent active tracing region started in the same scope.
 
 Tracing regions follow LIFO (last-in, first-out) order, and their scope is tied to the function
@@ -55,6 +115,255 @@ other functions or scopes.
 
 Tracing regions are closed in LIFO (last-in, first-out) order.
 
+The scope is a single call of a function, not the function itself: a StopTrace in a recursive call,
+in the same method called on another receiver or in another instantiation of a generic function
+doesn't end a region started by the caller.
+
+A StopTrace that doesn't match any open region is silently ignored.
+With DLG_STRICT=1 it panics instead, reporting the StopTrace callsite and the most recently started region.
+
 In builds without the dlg tag, StopTrace is a no-op.
 */
 func StopTrace(v ...any) {}
+
+/*
+Region is a handle to a single tracing region started by BeginRegion.
+
+In builds without the dlg tag, Region is an empty struct.
+*/
+type Region struct{}
+
+/*
+BeginRegion begins a tracing region and returns a handle identifying it.
+
+The region behaves like one started with StartTrace: it is tied to the function that
+called BeginRegion and covers every Printf made from that function or functions called by it.
+Unlike StartTrace, the returned Region identifies exactly one region. Calling End on it closes
+that region regardless of the order in which regions were started or the scope End is called from.
+Regions started with BeginRegion are never closed by StopTrace.
+
+name is a label describing the region.
+opts further configure the region, e.g. BindGoroutine restricts it to the calling goroutine.
+
+In builds without the dlg tag, BeginRegion is a no-op.
+*/
+func BeginRegion(name string, opts ...RegionOption) Region { return Region{} }
+
+/*
+BeginRegionTimeout begins a tracing region like BeginRegion, with a time budget of d.
+
+If the region is still open d after it was started, a warning is written to the output set by SetOutput.
+The warning contains the callsite that started the region and the current stack of the goroutine
+that started it, which shows where that goroutine is stuck. The region itself stays open until End is called.
+
+In builds without the dlg tag, BeginRegionTimeout is a no-op.
+*/
+func BeginRegionTimeout(name string, d time.Duration, opts ...RegionOption) Region { return Region{} }
+
+/*
+End closes the tracing region r.
+Calling End more than once, or on the zero Region, has no effect.
+With DLG_STRICT=1 calling End on a region that was already closed panics.
+
+In builds without the dlg tag, End is a no-op.
+*/
+func (r Region) End() {}
+
+/*
+RegionOption configures a tracing region started by BeginRegion.
+It is an opaque function type in every build; a nil RegionOption is ignored.
+
+In builds without the dlg tag, all options are nil.
+*/
+type RegionOption func(*regionOptions)
+
+// regionOptions is the opaque argument of RegionOption.
+type regionOptions struct{}
+
+/*
+BindGoroutine binds a tracing region to the goroutine calling BeginRegion.
+
+By default a tracing region covers every goroutine whose call stack passes through the function
+that started the region. A region bound to a goroutine only covers Printf calls made by the
+goroutine that started it, so tracing a single request doesn't produce stack traces for unrelated
+goroutines running the same code.
+
+In builds without the dlg tag, BindGoroutine is a no-op.
+*/
+func BindGoroutine() RegionOption { return nil }
+
+/*
+BindGoroutineTree binds a tracing region to the goroutine calling BeginRegion and the goroutines it spawns.
+
+It behaves like BindGoroutine but additionally covers every Printf call made by goroutines started
+by the owning goroutine, regardless of their call stack.
+Only direct children are known by default. Running the program with GODEBUG=tracebackancestors=N
+makes up to N generations of descendants visible.
+
+In builds without the dlg tag, BindGoroutineTree is a no-op.
+*/
+func BindGoroutineTree() RegionOption { return nil }
+
+/*
+WithTrace returns a copy of ctx that carries a tracing region.
+
+Unlike regions started by StartTrace or BeginRegion, which are tied to the call stack, the region
+follows the context across goroutines, channels and worker pools. Every call to PrintfContext
+with ctx, or a context derived from it, is treated as being inside a tracing region.
+The region lives as long as the context is in use; there is nothing to stop.
+
+In builds without the dlg tag, WithTrace returns ctx unchanged.
+*/
+func WithTrace(ctx context.Context) context.Context { return ctx }
+
+/*
+ActiveRegions returns the tracing regions that are currently open, oldest first.
+
+Regions that are started but never stopped keep producing stack traces for as long as the
+program runs. ActiveRegions reports where each open region was started and how long ago,
+which helps to find the missing StopTrace or End.
+
+In builds without the dlg tag, ActiveRegions returns nil.
+*/
+func ActiveRegions() []RegionInfo { return nil }
+
+/*
+Close writes a report of all tracing regions that are still open to the output set by SetOutput.
+Nothing is written if every region has been closed.
+Call Close right before the program exits, e.g. at the end of main.
+
+In builds without the dlg tag, Close is a no-op.
+*/
+func Close() {}
+
+/*
+TraceAlways makes every Printf call inside the region include a stack trace,
+regardless of DLG_STACKTRACE.
+
+The stack trace policy of the innermost region that has one takes precedence over DLG_STACKTRACE.
+This allows tracing one suspicious region in full while another, noisier region only traces errors.
+
+In builds without the dlg tag, TraceAlways is a no-op.
+*/
+func TraceAlways() RegionOption { return nil }
+
+/*
+TraceOnError makes Printf calls inside the region include a stack trace only if an argument is an error,
+regardless of DLG_STACKTRACE.
+
+In builds without the dlg tag, TraceOnError is a no-op.
+*/
+func TraceOnError() RegionOption { return nil }
+
+/*
+TraceNever suppresses stack traces for Printf calls inside the region, regardless of DLG_STACKTRACE.
+
+In builds without the dlg tag, TraceNever is a no-op.
+*/
+func TraceNever() RegionOption { return nil }
+
+/*
+TraceFirst makes the first n Printf calls inside the region include a stack trace, regardless of DLG_STACKTRACE.
+Later calls don't include stack traces.
+
+In builds without the dlg tag, TraceFirst is a no-op.
+*/
+func TraceFirst(n int) RegionOption { return nil }
+
+/*
+WriteTo redirects the output of Printf calls inside the region to w instead of the output set by SetOutput.
+
+This allows collecting everything that happened during a single operation, e.g. in a per-request buffer,
+and dumping it together. If regions with their own output are nested, the innermost one receives the output.
+Like with SetOutput, w should implement [sync.Locker] if it is shared between goroutines.
+
+In builds without the dlg tag, WriteTo is a no-op.
+*/
+func WriteTo(w io.Writer) RegionOption { return nil }
+
+/*
+CopyTo writes the output of Printf calls inside the region to w in addition to the output set by SetOutput.
+
+In builds without the dlg tag, CopyTo is a no-op.
+*/
+func CopyTo(w io.Writer) RegionOption { return nil }
+
+/*
+TracePackage marks every function of the calling package as a tracing region.
+
+Printf calls made from the package, or from functions called by it, behave as if they were inside
+a region started with StartTrace. Call it from the package's init function to get stack traces for
+a whole package under DLG_STACKTRACE=REGION,ALWAYS or REGION,ERROR without starting regions in every function.
+
+In builds without the dlg tag, TracePackage is a no-op.
+*/
+func TracePackage() {}
+
+/*
+Value writes v along with its callsite, like Printf with the %+v verb, and returns v unchanged.
+As it returns its argument it can be dropped into the middle of an expression:
+
+	total := dlg.Value(price * qty) + shipping
+
+The argument expression is read from the caller's source file and printed in front of the value
+e.g. "cart.go:31: price * qty = 36". If the source file is unavailable, e.g. in -trimpath builds,
+only the value is printed.
+
+In builds without the dlg tag, Value returns v and inlines away entirely.
+*/
+func Value[T any](v T) T { return v }
+
+/*
+LabeledValue is like Value but prefixes the value with label e.g. "total = 42".
+
+In builds without the dlg tag, LabeledValue returns v and inlines away entirely.
+*/
+func LabeledValue[T any](label string, v T) T { return v }
+
+/*
+Lazy wraps fn as an argument for Printf. fn is only called when the argument gets formatted,
+so expensive computations don't need to happen upfront:
+
+	dlg.Printf("state: %v", dlg.Lazy(cache.Dump))
+
+Arguments to Printf are evaluated even in builds without the dlg tag, only Printf itself is eliminated.
+Wrapping a call in Lazy removes the call as well, keeping the promise of zero cost.
+
+In builds without the dlg tag, Lazy returns nil and fn is never called.
+*/
+func Lazy[T any](fn func() T) any { return nil }
+
+/*
+Dump writes each of v as an indented, type-annotated tree, preceded by the same header as Printf:
+
+	12:00:01 [3µs] main.go:12: *main.Config &{
+	  Name: string "api"
+	  Ports: []int len=2 {
+	    0: int 80
+	    1: int 443
+	  }
+	  Parent: *main.Config <cycle>
+	}
+
+Structs, maps, slices, arrays, pointers and interfaces are expanded, including unexported fields.
+Cycles are detected and shown as <cycle>. Nesting deeper than 8 levels, more than 64 elements
+per slice or map and strings longer than 256 bytes are cut short. Map entries are sorted by key.
+
+In builds without the dlg tag, Dump is a no-op.
+*/
+func Dump(v ...any) {}
+
+/*
+Diff writes the differences between a and b, preceded by the same header as Printf.
+Only differing fields, elements and map entries are listed, each with its path:
+
+	12:00:01 [3µs] main.go:12: 2 differences
+	  .Items[3].Price: 10 -> 12
+	  .Tags["env"]: "dev" -> <missing>
+
+Pointers and interfaces are followed, unexported fields are compared as well and cycles are detected.
+Nil and empty slices and maps are considered equal.
+
+In builds without the dlg tag, Diff is a no-op.
+*/
+func Diff(a, b any) {}
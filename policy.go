@@ -0,0 +1,69 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"sync/atomic"
+)
+
+// Stack trace policies of a region
+const (
+	// Follow DLG_STACKTRACE
+	policyDefault = iota
+	policyAlways
+	policyOnError
+	policyNever
+	// Trace the first n Printf calls inside the region
+	policyFirst
+)
+
+func TraceAlways() RegionOption {
+	return func(c *caller) {
+		c.policy = policyAlways
+	}
+}
+
+func TraceOnError() RegionOption {
+	return func(c *caller) {
+		c.policy = policyOnError
+	}
+}
+
+func TraceNever() RegionOption {
+	return func(c *caller) {
+		c.policy = policyNever
+	}
+}
+
+func TraceFirst(n int) RegionOption {
+	return func(c *caller) {
+		c.policy = policyFirst
+		c.policyN = int64(n)
+	}
+}
+
+// traces reports whether a Printf call with arguments v inside region c gets a stack trace according to c's policy.
+// Must only be called for regions with a policy other than policyDefault.
+func (c *caller) traces(v []any) bool {
+	switch c.policy {
+	case policyAlways:
+		return true
+	case policyOnError:
+		return hasError(v)
+	case policyFirst:
+		return atomic.AddInt64(&c.calls, 1) <= c.policyN
+	default:
+		return false
+	}
+}
+
+// regionPolicy returns the innermost region with a policy other than policyDefault.
+// regions are expected to be ordered from innermost to outermost.
+func regionPolicy(regions []*caller) *caller {
+	for _, c := range regions {
+		if c.policy != policyDefault {
+			return c
+		}
+	}
+	return nil
+}
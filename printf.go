@@ -3,6 +3,7 @@
 package dlg
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -20,18 +21,30 @@ var (
 	// Initial Printf buffer size
 	bufSize = 128
 
-	// DLG_STACKTRACE and DLG_COLORS must be set using linker flags only:
+	// DLG_STACKTRACE, DLG_COLORS, DLG_REGION_EVENTS, DLG_STRICT, DLG_REGION, DLG_ONLY, DLG_REGION_INDENT and DLG_REGION_FILES must be set using linker flags only:
 	// e.g. go build -tags dlg -ldflags "-X github.com/vvvvv/dlg.DLG_STACKTRACE=ALWAYS"
 	// Packages importing dlg MUST NOT read from or write to this variable - doing so won't have any effect and will result in a compilation error when the dlg build tag is omitted.
-	DLG_STACKTRACE = ""
-	DLG_COLOR      = ""
+	DLG_STACKTRACE    = ""
+	DLG_COLOR         = ""
+	DLG_REGION_EVENTS = ""
+	DLG_STRICT        = ""
+	DLG_REGION        = ""
+	DLG_ONLY          = ""
+	DLG_REGION_INDENT = ""
+	DLG_REGION_FILES  = ""
 
 	termColor []byte
 )
 
+const Enabled = true
+
 // Include stack trace on error or on every call to Printf
 var stackflags = 0
 
+// Suppress Printf calls outside of tracing regions.
+// Set by DLG_ONLY=REGION.
+var onlyRegions = false
+
 const (
 	onerror = 1 << iota
 	always
@@ -44,9 +57,52 @@ var bufPool = sync.Pool{
 }
 
 func Printf(f string, v ...any) {
+	printf(0, nil, f, v)
+}
+
+func PrintfContext(ctx context.Context, f string, v ...any) {
+	printf(0, ctx, f, v)
+}
+
+func PrintfDepth(skip int, f string, v ...any) {
+	if skip < 0 {
+		skip = 0
+	}
+	printf(skip, nil, f, v)
+}
+
+func Do(fn func()) {
+	fn()
+}
+
+// printf formats and writes a log line.
+// skip is the number of additional stack frames to skip when reporting the callsite and stack trace,
+// with 0 identifying the caller of Printf.
+// ctx is optional and may carry a tracing region started by WithTrace.
+func printf(skip int, ctx context.Context, f string, v []any) {
+	// Regions covering this call.
+	// Looked up upfront only if they're needed for filtering or the log header.
+	var (
+		regionsBuf [maxRegions]*caller
+		regions    []*caller
+		lookedUp   bool
+	)
+	if onlyRegions ||
+		regionIndent != indentNone ||
+		atomic.LoadInt32(&namedCount) > 0 ||
+		atomic.LoadInt32(&policyCount) > 0 ||
+		atomic.LoadInt32(&sinkCount) > 0 {
+		regions = tracingRegions(1, regionsBuf[:0], -1)
+		lookedUp = true
+	}
+
+	if onlyRegions && len(regions) == 0 && !inContextRegion(ctx) {
+		return
+	}
+
 	b := bufPool.Get().([]byte)
 
-	formatInfo(&b)
+	formatInfo(&b, regions, skip)
 	if len(v) == 0 && strings.IndexByte(f, '%') < 0 {
 		// If there's no formatting we take a fast path
 		b = append(b, f...)
@@ -56,17 +112,34 @@ func Printf(f string, v ...any) {
 		b = fmt.Appendf(b, f, v...)
 	}
 
-	if stackflags != 0 &&
+	if c := regionPolicy(regions); c != nil {
+		// The innermost region with a policy overrides DLG_STACKTRACE
+		if c.traces(v) {
+			writeStack(&b, skip)
+		}
+	} else if stackflags != 0 &&
 		((stackflags&onerror != 0 && hasError(v)) ||
 			(stackflags&always != 0)) {
 
-		if (stackflags&region != 0 && inTracingRegion(1)) || (stackflags&region == 0) {
-			writeStack(&b)
+		if stackflags&region == 0 ||
+			inContextRegion(ctx) ||
+			(lookedUp && len(regions) > 0) ||
+			(!lookedUp && inTracingRegion(1)) {
+			writeStack(&b, skip)
 		}
 	}
 
-	writeOut := writeOutput.Load().(writeOutputFn)
-	writeOut(b)
+	if c := regionSink(regions); c != nil {
+		// The innermost region with a sink receives the output
+		c.sink(b)
+		if c.tee {
+			writeOut := writeOutput.Load().(writeOutputFn)
+			writeOut(b)
+		}
+	} else {
+		writeOut := writeOutput.Load().(writeOutputFn)
+		writeOut(b)
+	}
 
 	// Remove buffers with a capacity greater than 32kb from the sync.Pool in order to keep the footprint small
 	if cap(b) >= (1 << 15) {
@@ -81,8 +154,23 @@ func Printf(f string, v ...any) {
 // Set on package init
 var timeStart time.Time
 
-// formatInfo appends timestamp, elapsed time, and source location to the buffer.
-func formatInfo(buf *[]byte) {
+// formatInfo appends timestamp, elapsed time, names of enclosing regions and source location to the buffer.
+// skip is passed on to callsite.
+func formatInfo(buf *[]byte, regions []*caller, skip int) {
+	timestamp(buf)
+
+	// Region depth
+	indent(buf, regions)
+
+	// Enclosing regions e.g. {checkout>payment}
+	regionNames(buf, regions)
+
+	// Source file, line number
+	callsite(buf, skip)
+}
+
+// timestamp appends the current time and the time elapsed since program start to the buffer.
+func timestamp(buf *[]byte) {
 	now := time.Now().UTC()
 	since := now.Sub(timeStart).String()
 
@@ -94,9 +182,6 @@ func formatInfo(buf *[]byte) {
 
 	// Elapsed time
 	elapsed(buf, &since)
-
-	// Source file, line number
-	callsite(buf)
 }
 
 // padTime formats hours, minutes, seconds as two digit values
@@ -121,6 +206,31 @@ func elapsed(buf *[]byte, since *string) {
 	*buf = append(*buf, "] "...)
 }
 
+// regionNames appends the names of named regions, outermost first, separated by '>'.
+// regions are expected to be ordered from innermost to outermost.
+// Nothing is appended if none of the regions has a name.
+func regionNames(buf *[]byte, regions []*caller) {
+	named := false
+	for i := len(regions) - 1; i >= 0; i-- {
+		name := regions[i].name
+		if name == "" {
+			continue
+		}
+
+		if named {
+			*buf = append(*buf, '>')
+		} else {
+			*buf = append(*buf, '{')
+			named = true
+		}
+		*buf = append(*buf, name...)
+	}
+
+	if named {
+		*buf = append(*buf, "} "...)
+	}
+}
+
 // pad i with zeros according to the specified width
 func pad(buf *[]byte, i int, width int) {
 	width -= 1
@@ -138,31 +248,20 @@ func pad(buf *[]byte, i int, width int) {
 
 // callsite Appends the filename and line number.
 // It optionally colors the output.
-func callsite(buf *[]byte) {
+func callsite(buf *[]byte, skip int) {
 	// Calldepth skips n frames for reporting the correct file and line number
 	// 0 = runtime -> extern.go
 	// 1 = callsite -> printf.go
 	// 2 = formatInfo -> printf.go
-	// 3 = Printf -> printf.go
-	// 4 = callerFn
-	const calldepth = 4
-	pcs := make([]uintptr, 1)
-	n := runtime.Callers(calldepth, pcs)
+	// 3 = printf -> printf.go
+	// 4 = Printf -> printf.go
+	// 5 = callerFn
+	const calldepth = 5
 
 	fileName := "no_file"
 	lineNr := 0
-	if n != 0 {
-		frames := runtime.CallersFrames(pcs)
-		frame, _ := frames.Next()
-
-		fileName = frame.File
-		for i := len(fileName) - 1; i > 0; i-- {
-			if fileName[i] == '/' {
-				fileName = fileName[i+1:]
-				break
-			}
-		}
-
+	if frame, ok := callerFrame(calldepth + skip); ok {
+		fileName = baseName(frame.File)
 		lineNr = frame.Line
 	}
 
@@ -175,6 +274,16 @@ func callsite(buf *[]byte) {
 	*buf = append(*buf, ": "...)
 }
 
+// baseName returns the last element of a slash separated file path.
+func baseName(file string) string {
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '/' {
+			return file[i+1:]
+		}
+	}
+	return file
+}
+
 // hasError returns whether any argument is an error.
 func hasError(args []any) bool {
 	for i := len(args) - 1; i >= 0; i-- {
@@ -196,25 +305,29 @@ var defaultWriteOutput = func(buf []byte) (n int, err error) {
 // SetOutput sets the output destination for Printf.
 // Defaults to os.Stderr.
 func SetOutput(w io.Writer) {
+	writeOutput.Store(newWriteOutputFn(w))
+}
+
+// newWriteOutputFn returns a writeOutputFn writing to w.
+// Writes are guarded by w's lock if w implements sync.Locker.
+// A nil writer discards all output.
+func newWriteOutputFn(w io.Writer) writeOutputFn {
 	if w == nil {
 		w = io.Discard
 	}
 
-	var fn writeOutputFn
 	if locker, ok := w.(sync.Locker); ok {
-		fn = func(buf []byte) (n int, err error) {
+		return func(buf []byte) (n int, err error) {
 			locker.Lock()
 			n, err = w.Write(buf)
 			locker.Unlock()
 			return
 		}
-	} else {
-		fn = func(buf []byte) (int, error) {
-			return w.Write(buf)
-		}
 	}
 
-	writeOutput.Store(fn)
+	return func(buf []byte) (int, error) {
+		return w.Write(buf)
+	}
 }
 
 func env(name string) (v string, ok bool) {
@@ -223,6 +336,22 @@ func env(name string) (v string, ok bool) {
 	return strings.ToLower(v), ok
 }
 
+// setting returns the value of a setting configured either at compile time via the linker flag value ldflag
+// or at runtime via the environment variable DLG_<name>.
+// Linker flags take precedence.
+func setting(ldflag string, name string) (v string, ok bool) {
+	if ldflag != "" {
+		return strings.ToLower(ldflag), true
+	}
+	return env(name)
+}
+
+// enabled reports whether a boolean setting is switched on.
+// Any value other than "", "0" and "false" counts as on.
+func enabled(v string, ok bool) bool {
+	return ok && v != "" && v != "0" && v != "false"
+}
+
 func init() {
 	defer func() {
 		timeStart = time.Now().UTC()
@@ -236,9 +365,8 @@ func init() {
 		// Pre init buffer pool
 		bufPool.Put(make([]byte, 0, bufSize))
 
-		// Initialize trace region store
-		callers := make([]caller, 0, 16)
-		callersStore.Store(callers)
+		// Initialize the entry PC set of open regions
+		storeEntries(nil, nil)
 	}()
 
 	defer func() {
@@ -259,6 +387,12 @@ func init() {
 - DLG_STACKTRACE=ERROR   show stack traces on errors
 - DLG_STACKTRACE=ALWAYS  show stack traces always
 - DLG_STACKTRACE=REGION  show stack traces in trace regions 
+- DLG_REGION_EVENTS=1    show when regions are entered and exited
+- DLG_STRICT=1           panic on misuse of tracing regions
+- DLG_REGION=<regexp>    trace regions for functions matching regexp
+- DLG_REGION_FILES=<f:l> trace regions for files and line ranges
+- DLG_ONLY=REGION        only print inside tracing regions
+- DLG_REGION_INDENT=1    indent output by region depth (TREE draws a tree)
 - DLG_NO_WARN=1          disable this message (use at your own risk)
 
 `)
@@ -275,6 +409,54 @@ func init() {
 		}
 	}
 
+	// Check if region enter/exit events should get printed
+	regionEvents = enabled(setting(DLG_REGION_EVENTS, "REGION_EVENTS"))
+
+	// Check if misuse of the region API should panic
+	strict = enabled(setting(DLG_STRICT, "STRICT"))
+
+	// Check if output should be limited to tracing regions
+	if only, ok := setting(DLG_ONLY, "ONLY"); ok && only != "" {
+		if len(only) >= 3 && only[:3] == "reg" {
+			onlyRegions = true
+		} else {
+			fmt.Fprintf(os.Stderr, " dlg: Invalid Argument DLG_ONLY: invalid argument %q\n", only)
+		}
+	}
+
+	// Check if output should be indented by region depth
+	regionIndent = parseRegionIndent(setting(DLG_REGION_INDENT, "REGION_INDENT"))
+
+	// Check if static regions are declared.
+	// Not using setting() as regular expressions are case sensitive.
+	regionFuncs := DLG_REGION
+	if regionFuncs == "" {
+		regionFuncs = os.Getenv("DLG_REGION")
+	}
+	if regionFuncs != "" {
+		if re, err := parseRegionFuncs(regionFuncs); err != nil {
+			fmt.Fprintf(os.Stderr, " dlg: Invalid Argument DLG_REGION: %v\n", err)
+		} else {
+			regionFuncRegexp = re
+			hasStaticRegions.Store(true)
+		}
+	}
+
+	// Check if files or line ranges are declared as static regions.
+	// Not using setting() as file names are case sensitive.
+	files := DLG_REGION_FILES
+	if files == "" {
+		files = os.Getenv("DLG_REGION_FILES")
+	}
+	if files != "" {
+		if ranges, err := parseRegionFiles(files); err != nil {
+			fmt.Fprintf(os.Stderr, " dlg: Invalid Argument DLG_REGION_FILES: %v\n", err)
+		} else if len(ranges) > 0 {
+			regionFiles = ranges
+			hasStaticRegions.Store(true)
+		}
+	}
+
 	// check if stack traces should get generated
 	stacktrace := DLG_STACKTRACE
 	if stacktrace == "" {
@@ -0,0 +1,20 @@
+package dlg
+
+import (
+	"time"
+)
+
+/*
+RegionInfo describes an open tracing region as reported by ActiveRegions.
+*/
+type RegionInfo struct {
+	// Name of the region. Empty for regions started by StartTrace.
+	Name string
+	// Fully qualified name of the function that started the region.
+	Function string
+	// File and Line of the call that started the region.
+	File string
+	Line int
+	// Age is the time passed since the region was started.
+	Age time.Duration
+}
@@ -0,0 +1,75 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"slices"
+	"time"
+)
+
+func ActiveRegions() []RegionInfo {
+	var regions []RegionInfo
+	now := time.Now()
+	for c := newestCaller.Load(); c != nil; c = c.older.Load() {
+		regions = append(regions, RegionInfo{
+			Name:     c.name,
+			Function: c.id,
+			File:     c.file,
+			Line:     c.line,
+			Age:      now.Sub(c.start),
+		})
+	}
+	// Oldest first
+	slices.Reverse(regions)
+	return regions
+}
+
+func Close() {
+	writeLeakReport()
+}
+
+// writeLeakReport writes a report listing every region that is still open e.g.
+//
+//	12:00:01 [1.2s] 2 unclosed regions:
+//	  "db" started at repo.go:12 in main.(*Repo).Query 1.19s ago
+//	  region started at handler.go:40 in main.handle 800ms ago
+//
+// Nothing is written if all regions have been closed.
+func writeLeakReport() {
+	regions := ActiveRegions()
+	if len(regions) == 0 {
+		return
+	}
+
+	b := bufPool.Get().([]byte)
+
+	timestamp(&b)
+	pad(&b, len(regions), -1)
+	if len(regions) == 1 {
+		b = append(b, " unclosed region:\n"...)
+	} else {
+		b = append(b, " unclosed regions:\n"...)
+	}
+
+	for _, r := range regions {
+		b = append(b, "  "...)
+		if r.Name != "" {
+			b = append(b, '"')
+			b = append(b, r.Name...)
+			b = append(b, `" `...)
+		} else {
+			b = append(b, "region "...)
+		}
+		b = append(b, "started at "...)
+		b = append(b, baseName(r.File)...)
+		b = append(b, ':')
+		pad(&b, r.Line, -1)
+		b = append(b, " in "...)
+		b = append(b, r.Function...)
+		b = append(b, ' ')
+		b = append(b, r.Age.String()...)
+		b = append(b, " ago\n"...)
+	}
+
+	writeEvent(b)
+}
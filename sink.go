@@ -0,0 +1,32 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"io"
+)
+
+func WriteTo(w io.Writer) RegionOption {
+	return func(c *caller) {
+		c.sink = newWriteOutputFn(w)
+		c.tee = false
+	}
+}
+
+func CopyTo(w io.Writer) RegionOption {
+	return func(c *caller) {
+		c.sink = newWriteOutputFn(w)
+		c.tee = true
+	}
+}
+
+// regionSink returns the innermost region with its own output.
+// regions are expected to be ordered from innermost to outermost.
+func regionSink(regions []*caller) *caller {
+	for _, c := range regions {
+		if c.sink != nil {
+			return c
+		}
+	}
+	return nil
+}
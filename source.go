@@ -0,0 +1,150 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sourceFile is a parsed Go source file.
+type sourceFile struct {
+	fset *token.FileSet
+	file *ast.File
+	src  []byte
+}
+
+var (
+	sourceMu sync.Mutex
+	// Parsed source files by path. nil if the file is unavailable, e.g. in -trimpath builds.
+	sourceFiles = make(map[string]*sourceFile)
+	// Argument expressions of value helper calls by return PC. Empty if unknown.
+	exprCache = make(map[uintptr]string)
+)
+
+// callExpr returns the source text of the first argument of the call to the function fn
+// made skip frames above callExpr's caller e.g. user.Balance*rate for
+//
+//	dlg.Value(user.Balance*rate)
+//
+// The caller's source file is read and parsed once and cached.
+// An empty string is returned if the source is unavailable or the call can't be told apart
+// from another call to fn on the same line.
+func callExpr(skip int, fn string) string {
+	var pc [1]uintptr
+	if runtime.Callers(skip+2, pc[:]) == 0 {
+		return ""
+	}
+
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+
+	if expr, ok := exprCache[pc[0]]; ok {
+		return expr
+	}
+
+	frame, _ := runtime.CallersFrames(pc[:]).Next()
+	expr := findCallExpr(loadSource(frame.File), frame.Line, fn)
+	exprCache[pc[0]] = expr
+	return expr
+}
+
+// loadSource returns the parsed source file at path, or nil if it can't be read or parsed.
+// sourceMu must be held.
+func loadSource(path string) *sourceFile {
+	if sf, ok := sourceFiles[path]; ok {
+		return sf
+	}
+
+	var sf *sourceFile
+	if src, err := os.ReadFile(path); err == nil {
+		fset := token.NewFileSet()
+		if file, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution); err == nil {
+			sf = &sourceFile{fset: fset, file: file, src: src}
+		}
+	}
+
+	sourceFiles[path] = sf
+	return sf
+}
+
+// findCallExpr returns the source text of the first argument of the call to dlg's function fn on the given line.
+// Calls are matched by the name dlg is imported as in the file, so dlg.Value, d.Value for an import renamed to d
+// and a dot imported Value all match fn "Value" while ctx.Value doesn't.
+func findCallExpr(sf *sourceFile, line int, fn string) string {
+	if sf == nil {
+		return ""
+	}
+	pkg := importName(sf.file, dlgPackage)
+	if pkg == "" {
+		return ""
+	}
+
+	var exprs []string
+	ast.Inspect(sf.file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 || !isCallTo(call.Fun, pkg, fn) {
+			return true
+		}
+
+		start, end := sf.fset.Position(call.Pos()).Line, sf.fset.Position(call.End()).Line
+		if line < start || line > end {
+			return true
+		}
+
+		arg := call.Args[0]
+		from, to := sf.fset.Position(arg.Pos()).Offset, sf.fset.Position(arg.End()).Offset
+		exprs = append(exprs, strings.Join(strings.Fields(string(sf.src[from:to])), " "))
+		return true
+	})
+
+	if len(exprs) == 0 {
+		return ""
+	}
+	for _, expr := range exprs[1:] {
+		if expr != exprs[0] {
+			// Ambiguous; more than one call on the same line.
+			return ""
+		}
+	}
+	return exprs[0]
+}
+
+// importName returns the name the package at path is imported as in file, "." if it is dot imported
+// or an empty string if it isn't imported.
+func importName(file *ast.File, path string) string {
+	for _, imp := range file.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err != nil || p != path {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name
+		}
+		return path[strings.LastIndexByte(path, '/')+1:]
+	}
+	return ""
+}
+
+// isCallTo reports whether fun, the called expression of a call, refers to the function fn
+// of the package imported as pkg e.g. dlg.Value[int] for pkg dlg and fn Value.
+func isCallTo(fun ast.Expr, pkg, fn string) bool {
+	switch f := fun.(type) {
+	case *ast.Ident:
+		return pkg == "." && f.Name == fn
+	case *ast.SelectorExpr:
+		x, ok := f.X.(*ast.Ident)
+		return ok && x.Name == pkg && f.Sel.Name == fn
+	case *ast.IndexExpr:
+		return isCallTo(f.X, pkg, fn)
+	case *ast.IndexListExpr:
+		return isCallTo(f.X, pkg, fn)
+	default:
+		return false
+	}
+}
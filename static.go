@@ -0,0 +1,188 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Static regions are declared instead of being started and stopped in code.
+// A frame is inside a static region if its function matches DLG_REGION, belongs to a package passed to TracePackage
+// or its source location is covered by DLG_REGION_FILES.
+var (
+	hasStaticRegions atomic.Bool
+	// Matches fully qualified function names. Set by DLG_REGION.
+	regionFuncRegexp *regexp.Regexp
+	// Set of package paths traced via TracePackage (map[string]struct{}).
+	tracedPackages   atomic.Value
+	tracedPackagesMu sync.Mutex
+	// Source files and line ranges. Set by DLG_REGION_FILES.
+	regionFiles []fileRange
+)
+
+// Import path of dlg.
+const dlgPackage = "github.com/vvvvv/dlg"
+
+// staticRegion is reported by tracingRegions for frames inside a static region.
+// It is never linked as an open region.
+var staticRegion = &caller{id: "DLG_REGION"}
+
+// inStaticRegion reports whether the function fn is inside a static region.
+func inStaticRegion(fn string) bool {
+	if regionFuncRegexp != nil && regionFuncRegexp.MatchString(fn) {
+		return true
+	}
+
+	if pkgs, ok := tracedPackages.Load().(map[string]struct{}); ok {
+		_, traced := pkgs[funcPackage(fn)]
+		return traced
+	}
+	return false
+}
+
+// inStaticFrame reports whether frame is inside a static region.
+func inStaticFrame(frame runtime.Frame) bool {
+	if inStaticRegion(frame.Function) {
+		return true
+	}
+	for _, r := range regionFiles {
+		if r.covers(frame.File, frame.Line) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileRange is a range of lines of a source file declared as region by DLG_REGION_FILES.
+type fileRange struct {
+	// File name or trailing part of the file path e.g. handler.go or api/handler.go
+	path string
+	// Covered lines, inclusive. to is 0 if the whole file is covered.
+	from, to int
+}
+
+// covers reports whether file:line is inside r.
+func (r fileRange) covers(file string, line int) bool {
+	if file != r.path && !(strings.HasSuffix(file, r.path) && file[len(file)-len(r.path)-1] == '/') {
+		return false
+	}
+	return r.to == 0 || (line >= r.from && line <= r.to)
+}
+
+// inStaticFrames reports whether the return PC pc, or any function inlined at pc, is inside a static region.
+// Frames of dlg itself are never part of a static region; otherwise a pattern such as DLG_REGION=dlg\..* or
+// DLG_REGION_FILES=printf.go would match every call.
+func inStaticFrames(pc uintptr) bool {
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		frame, more := frames.Next()
+		if funcPackage(frame.Function) != dlgPackage && inStaticFrame(frame) {
+			return true
+		}
+
+		if !more {
+			return false
+		}
+	}
+}
+
+// parseRegionFiles parses the DLG_REGION_FILES list e.g.
+//
+//	handler.go:100-180,repo.go,api/user.go:42
+//
+// Each entry is a file, optionally followed by a single line or an inclusive range of lines.
+func parseRegionFiles(list string) ([]fileRange, error) {
+	var ranges []fileRange
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		path, lines, hasLines := strings.Cut(entry, ":")
+		r := fileRange{path: path}
+		if hasLines {
+			from, to, isRange := strings.Cut(lines, "-")
+
+			var err error
+			if r.from, err = strconv.Atoi(from); err != nil || r.from <= 0 {
+				return nil, fmt.Errorf("invalid line %q in %q", from, entry)
+			}
+			r.to = r.from
+			if isRange {
+				if r.to, err = strconv.Atoi(to); err != nil || r.to < r.from {
+					return nil, fmt.Errorf("invalid line range %q in %q", lines, entry)
+				}
+			}
+		}
+		if r.path == "" {
+			return nil, fmt.Errorf("missing file in %q", entry)
+		}
+
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// parseRegionFuncs compiles the DLG_REGION expression.
+// The expression has to match the fully qualified function name as a whole.
+func parseRegionFuncs(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + expr + `)$`)
+}
+
+func TracePackage() {
+	pc := make([]uintptr, 1)
+	if runtime.Callers(2, pc) == 0 {
+		return
+	}
+
+	frame, _ := runtime.CallersFrames(pc).Next()
+	if frame.Function == "" {
+		return
+	}
+	pkg := funcPackage(frame.Function)
+
+	tracedPackagesMu.Lock()
+	defer tracedPackagesMu.Unlock()
+
+	pkgs, _ := tracedPackages.Load().(map[string]struct{})
+	if _, ok := pkgs[pkg]; ok {
+		return
+	}
+
+	newPkgs := make(map[string]struct{}, len(pkgs)+1)
+	for p := range pkgs {
+		newPkgs[p] = struct{}{}
+	}
+	newPkgs[pkg] = struct{}{}
+	tracedPackages.Store(newPkgs)
+	hasStaticRegions.Store(true)
+
+	// Cached PCs of the package were looked up while it wasn't traced yet.
+	pcInfoMu.Lock()
+	pcInfoCache = make(map[uintptr]pcInfo, len(pcInfoCache))
+	pcInfoMu.Unlock()
+}
+
+// funcPackage returns the package path of the fully qualified function name fn e.g.
+//
+//	github.com/acme/svc/payment.(*Service).Charge   -> github.com/acme/svc/payment
+//	github.com/acme/svc/payment.Map[go.shape.int]   -> github.com/acme/svc/payment
+func funcPackage(fn string) string {
+	// Type arguments may contain package paths themselves.
+	if i := strings.IndexByte(fn, '['); i >= 0 {
+		fn = fn[:i]
+	}
+
+	slash := strings.LastIndexByte(fn, '/') + 1
+	if i := strings.IndexByte(fn[slash:], '.'); i >= 0 {
+		return fn[:slash+i]
+	}
+	return fn
+}
@@ -0,0 +1,61 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Panic on misuse of the region API instead of silently ignoring it.
+// Set by DLG_STRICT.
+var strict = false
+
+// misuse reports misuse of the region API, such as a StopTrace without a matching region.
+// Without strict mode misuse is silently ignored.
+// In strict mode misuse panics with a diagnostic naming the offending callsite and the most recently started open region.
+//
+// skip is the number of stack frames to ascend to the offending call, with 1 identifying the caller of misuse.
+func misuse(skip int, format string, v ...any) {
+	if !strict {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("dlg: ")
+	fmt.Fprintf(&b, format, v...)
+
+	if _, file, line, ok := runtime.Caller(skip); ok {
+		fmt.Fprintf(&b, "\n\tcalled at %s:%d", file, line)
+	}
+
+	if c := newestCaller.Load(); c == nil {
+		b.WriteString("\n\tno region is open")
+	} else {
+		fmt.Fprintf(&b, "\n\tmost recent open region %s started at %s:%d in %s", formatRegion(c), c.file, c.line, c.id)
+	}
+
+	panic(b.String())
+}
+
+// formatKey formats a region key as an argument list e.g. ("foo", 1).
+func formatKey(key []any) string {
+	args := make([]string, len(key))
+	for i, k := range key {
+		args[i] = fmt.Sprintf("%#v", k)
+	}
+	return "(" + strings.Join(args, ", ") + ")"
+}
+
+// formatRegion returns a short human readable description of region c.
+func formatRegion(c *caller) string {
+	switch {
+	case c.name != "":
+		return fmt.Sprintf("%q", c.name)
+	case len(c.key) > 0:
+		return "with key " + formatKey(c.key)
+	default:
+		return "(unnamed)"
+	}
+}
@@ -28,6 +28,16 @@ func (l logline) Line() string {
 	return ""
 }
 
+// Regions returns the region names from the log header, outermost first.
+func (l logline) Regions() []string {
+	regions := logRegionsRegexp.FindStringSubmatch(l.line)
+	if len(regions) > 1 {
+		return strings.Split(regions[1], ">")
+	}
+
+	return nil
+}
+
 func (l logline) HasTrace() bool {
 	return l.trace != ""
 }
@@ -37,10 +47,11 @@ var (
 	// This matches:
 	//                                v everything until there (including possible stack traces)
 	//  00:09:45 [4µs] main.go:16: foo 01:19:55 [8s] main.go:36: bar
-	logLineRegexp = regexp.MustCompile(`\d{2}:\d{2}:\d{2}\s+\[[^\]]+\]\s+\S+\.go:\d+:\s+.*?`)
+	logLineRegexp = regexp.MustCompile(`\d{2}:\d{2}:\d{2}\s+\[[^\]]+\]\s+(?:\{[^}]*\}\s+)?\S+\.go:\d+:\s+.*?`)
 	traceRegexp   = regexp.MustCompile(`(?:\S+\([^)]*\)\s+\S+\.go:\d+\s+\+0x[0-9A-Fa-f]+\s+)+`)
 
-	logSingleLineRegexp = regexp.MustCompile(`\d{2}:\d{2}:\d{2}\s+\[\d+\.?\d*.?s\]\s+\w+\.go:\d+:\s(.*)$`)
+	logSingleLineRegexp = regexp.MustCompile(`\d{2}:\d{2}:\d{2}\s+\[\d+\.?\d*.?s\]\s+(?:\{[^}]*\}\s+)?\w+\.go:\d+:\s(.*)$`)
+	logRegionsRegexp    = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}\s+\[[^\]]+\]\s+\{([^}]*)\}\s+`)
 )
 
 // ParseLines parses dlg.Printf output into line, trace.
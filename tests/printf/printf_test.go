@@ -4,12 +4,15 @@ package dlg_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"regexp"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/vvvvv/dlg"
 	"github.com/vvvvv/dlg/tests/internal"
@@ -31,6 +34,433 @@ func TestPrintfBasic(t *testing.T) {
 	}
 }
 
+func TestPrintfContextBasic(t *testing.T) {
+	out := internal.CaptureOutput(func() {
+		dlg.PrintfContext(context.Background(), "test %s", "message")
+	})
+
+	matched := logLineRegexp.MatchString(out)
+	if !matched {
+		t.Errorf("Output format mismatch. Got: %q ; Want: %q", out, "test message")
+	}
+}
+
+func TestPrintfRegionPolicyWithoutStackTraces(t *testing.T) {
+	out := internal.CaptureOutput(func() {
+		dlg.Printf("no trace")
+
+		r := dlg.BeginRegion("always", dlg.TraceAlways())
+		dlg.Printf("trace")
+		r.End()
+	})
+
+	lines := internal.ParseLines([]byte(out))
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines but got: %+v", lines)
+	}
+
+	if lines[0].HasTrace() || !lines[1].HasTrace() {
+		t.Errorf("Expected only the line inside the region to have a stack trace: Got: %q", out)
+	}
+}
+
+// logHelper is a wrapper around dlg.Printf marked as helper.
+func logHelper(f string, v ...any) {
+	dlg.Helper()
+	dlg.Printf(f, v...)
+}
+
+// logDepth is a wrapper around dlg.Printf skipping itself via PrintfDepth.
+func logDepth(f string, v ...any) {
+	dlg.PrintfDepth(1, f, v...)
+}
+
+func TestPrintfHelper(t *testing.T) {
+	var line int
+	out := internal.CaptureOutput(func() {
+		logHelper("message from helper")
+		_, _, line, _ = runtime.Caller(0)
+	})
+
+	want := fmt.Sprintf("printf_test.go:%d: message from helper", line-1)
+	if !strings.Contains(out, want) {
+		t.Errorf("Expected the callsite of the helper: want: %q ; got: %q", want, out)
+	}
+}
+
+func TestPrintfDepth(t *testing.T) {
+	var line int
+	out := internal.CaptureOutput(func() {
+		logDepth("message from wrapper")
+		_, _, line, _ = runtime.Caller(0)
+	})
+
+	want := fmt.Sprintf("printf_test.go:%d: message from wrapper", line-1)
+	if !strings.Contains(out, want) {
+		t.Errorf("Expected the callsite of the wrapper: want: %q ; got: %q", want, out)
+	}
+}
+
+func TestPrintfDepthNegative(t *testing.T) {
+	var line int
+	out := internal.CaptureOutput(func() {
+		dlg.PrintfDepth(-3, "negative skip")
+		_, _, line, _ = runtime.Caller(0)
+	})
+
+	want := fmt.Sprintf("printf_test.go:%d: negative skip", line-1)
+	if !strings.Contains(out, want) {
+		t.Errorf("Expected a negative skip to report the callsite of PrintfDepth: want: %q ; got: %q", want, out)
+	}
+}
+
+func TestValue(t *testing.T) {
+	var got int
+	out := internal.CaptureOutput(func() {
+		got = dlg.Value(6*7) + 1
+	})
+
+	if got != 43 {
+		t.Errorf("Expected Value to return its argument: want: %v ; got: %v", 43, got)
+	}
+
+	lines := internal.ParseLines([]byte(out))
+	if want := "6*7 = 42"; len(lines) != 1 || lines[0].Line() != want {
+		t.Errorf("Mismatch: want: %q ; got: %q", want, out)
+	}
+}
+
+func TestValueExpression(t *testing.T) {
+	type account struct {
+		Balance float64
+	}
+	user := account{Balance: 25}
+	rate := 0.5
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  []string
+	}{
+		{
+			name: "print the argument expression",
+			fn: func() {
+				_ = dlg.Value(user.Balance*rate) + 1
+			},
+			exp: []string{"user.Balance*rate = 12.5"},
+		},
+		{
+			name: "print expressions spanning multiple lines on a single line",
+			fn: func() {
+				_ = dlg.Value(
+					user.Balance +
+						rate,
+				)
+			},
+			exp: []string{"user.Balance + rate = 25.5"},
+		},
+		{
+			name: "print only the values of calls that can't be told apart",
+			fn: func() {
+				_ = dlg.Value(user.Balance) + dlg.Value(rate)
+			},
+			exp: []string{"25", "0.5"},
+		},
+		{
+			name: "ignore calls of functions named like Value of other packages",
+			fn: func() {
+				_ = dlg.Value(ctx.Value(ctxKey{}))
+			},
+			exp: []string{"ctx.Value(ctxKey{}) = value"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(tc.fn)
+			lines := internal.ParseLines([]byte(out))
+
+			if len(lines) != len(tc.exp) {
+				t.Fatalf("Testcase must contain all output; expected: %v ; got: %v\n%s", len(tc.exp), len(lines), out)
+			}
+
+			for i, want := range tc.exp {
+				if got := lines[i].Line(); got != want {
+					t.Errorf("Mismatch: want: %q ; got: %q", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLabeledValue(t *testing.T) {
+	type item struct {
+		Name  string
+		Price int
+	}
+
+	var got item
+	out := internal.CaptureOutput(func() {
+		got = dlg.LabeledValue("item", item{"book", 12})
+	})
+
+	if got != (item{"book", 12}) {
+		t.Errorf("Expected LabeledValue to return its argument: got: %+v", got)
+	}
+
+	lines := internal.ParseLines([]byte(out))
+	if want := "item = {Name:book Price:12}"; len(lines) != 1 || lines[0].Line() != want {
+		t.Errorf("Mismatch: want: %q ; got: %q", want, out)
+	}
+}
+
+func TestLazy(t *testing.T) {
+	calls := 0
+	answer := func() int {
+		calls++
+		return 42
+	}
+
+	out := internal.CaptureOutput(func() {
+		dlg.Printf("answer: %05d", dlg.Lazy(answer))
+	})
+
+	lines := internal.ParseLines([]byte(out))
+	if want := "answer: 00042"; len(lines) != 1 || lines[0].Line() != want {
+		t.Errorf("Mismatch: want: %q ; got: %q", want, out)
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected the lazy argument to be evaluated once: got: %v", calls)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	if !dlg.Enabled {
+		t.Errorf("Expected Enabled to be true in builds with the dlg tag")
+	}
+}
+
+func TestDo(t *testing.T) {
+	called := false
+	dlg.Do(func() {
+		called = true
+	})
+
+	if !called {
+		t.Errorf("Expected Do to call its function in builds with the dlg tag")
+	}
+}
+
+type dumpConfig struct {
+	Name   string
+	Ports  []int
+	Limits map[string]int
+	Parent *dumpConfig
+	err    error
+	secret *int
+}
+
+func TestDump(t *testing.T) {
+	cfg := &dumpConfig{
+		Name:   "api",
+		Ports:  []int{80, 443},
+		Limits: map[string]int{"rps": 100, "burst": 5},
+		err:    fmt.Errorf("boom"),
+	}
+	cfg.Parent = cfg
+
+	long := make([]int, 100)
+
+	type node struct {
+		Next *node
+	}
+	var deep *node
+	for i := 0; i < 12; i++ {
+		deep = &node{Next: deep}
+	}
+
+	tcs := []struct {
+		name string
+		v    []any
+		exp  string
+	}{
+		{
+			name: "dump nested values with cycles and unexported fields",
+			v:    []any{cfg},
+			exp: `*dlg_test.dumpConfig &{
+  Name: string "api"
+  Ports: []int len=2 {
+    0: int 80
+    1: int 443
+  }
+  Limits: map[string]int len=2 {
+    "burst": int 5
+    "rps": int 100
+  }
+  Parent: *dlg_test.dumpConfig <cycle>
+  err: error(*errors.errorString) &{
+    s: string "boom"
+  }
+  secret: *int nil
+}`,
+		},
+		{
+			name: "dump multiple values",
+			v:    []any{1, "two", nil},
+			exp: `int 1
+string "two"
+nil`,
+		},
+		{
+			name: "limit the number of elements",
+			v:    []any{long},
+			exp:  `(?s)^\[\]int len=100 \{\n  0: int 0\n.*\n  63: int 0\n  \.\.\. 36 more\n\}$`,
+		},
+		{
+			name: "limit the nesting depth",
+			v:    []any{deep},
+			exp:  `(?s)^\*dlg_test\.node &\{\n  Next: \*dlg_test\.node &\{.*&\{\.\.\.\}(\n *\})+$`,
+		},
+	}
+
+	header := regexp.MustCompile(`^\d{2}:\d{2}:\d{2} \[[^\]]+\] printf_test\.go:\d+: `)
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(func() {
+				dlg.Dump(tc.v...)
+			})
+
+			if !header.MatchString(out) {
+				t.Fatalf("Expected the Printf header: got: %q", out)
+			}
+			got := strings.TrimSuffix(header.ReplaceAllString(out, ""), "\n")
+
+			if strings.HasPrefix(tc.exp, "(?s)") {
+				if !regexp.MustCompile(tc.exp).MatchString(got) {
+					t.Errorf("Mismatch: want: %q ; got: %q", tc.exp, got)
+				}
+			} else if got != tc.exp {
+				t.Errorf("Mismatch: want:\n%s\ngot:\n%s", tc.exp, got)
+			}
+		})
+	}
+}
+
+type diffItem struct {
+	Name  string
+	Price int
+}
+
+type diffOrder struct {
+	ID    int
+	Items []diffItem
+	Tags  map[string]string
+	Note  *string
+	Next  *diffOrder
+	meta  any
+}
+
+func TestDiff(t *testing.T) {
+	note := "gift"
+	before := diffOrder{
+		ID:    1,
+		Items: []diffItem{{"book", 10}, {"pen", 2}},
+		Tags:  map[string]string{"env": "dev", "team": "a"},
+		meta:  1,
+	}
+	after := diffOrder{
+		ID:    1,
+		Items: []diffItem{{"book", 12}, {"pen", 2}, {"ink", 5}},
+		Tags:  map[string]string{"team": "b"},
+		Note:  &note,
+		meta:  "1",
+	}
+
+	cyclicA := &diffOrder{ID: 1}
+	cyclicA.Next = cyclicA
+	cyclicB := &diffOrder{ID: 2}
+	cyclicB.Next = cyclicB
+	cyclicSliceA := []any{nil, 1}
+	cyclicSliceA[0] = cyclicSliceA
+	cyclicSliceB := []any{nil, 2}
+	cyclicSliceB[0] = cyclicSliceB
+
+	tcs := []struct {
+		name string
+		a, b any
+		exp  string
+	}{
+		{
+			name: "report differing fields and elements with their path",
+			a:    before,
+			b:    after,
+			exp: `6 differences
+  .Items[0].Price: 10 -> 12
+  .Items[2]: <missing> -> dlg_test.diffItem{...}
+  .Tags["env"]: "dev" -> <missing>
+  .Tags["team"]: "a" -> "b"
+  .Note: nil -> &"gift"
+  .meta: (int) 1 -> (string) "1"`,
+		},
+		{
+			name: "report no differences for equal values",
+			a:    before,
+			b:    before,
+			exp:  `no differences`,
+		},
+		{
+			name: "report differing types",
+			a:    1,
+			b:    "1",
+			exp: `1 difference
+  (int) 1 -> (string) "1"`,
+		},
+		{
+			name: "pair map entries by key, not by printed key",
+			a:    map[any]string{1: "int", int64(1): "int64"},
+			b:    map[any]string{1: "int", int64(1): "changed"},
+			exp: `1 difference
+  [1]: "int64" -> "changed"`,
+		},
+		{
+			name: "stop at cycles",
+			a:    cyclicA,
+			b:    cyclicB,
+			exp: `1 difference
+  .ID: 1 -> 2`,
+		},
+		{
+			name: "stop at cycles through slices",
+			a:    cyclicSliceA,
+			b:    cyclicSliceB,
+			exp: `1 difference
+  [1]: 1 -> 2`,
+		},
+	}
+
+	header := regexp.MustCompile(`^\d{2}:\d{2}:\d{2} \[[^\]]+\] printf_test\.go:\d+: `)
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(func() {
+				dlg.Diff(tc.a, tc.b)
+			})
+
+			if !header.MatchString(out) {
+				t.Fatalf("Expected the Printf header: got: %q", out)
+			}
+
+			if got := strings.TrimSuffix(header.ReplaceAllString(out, ""), "\n"); got != tc.exp {
+				t.Errorf("Mismatch: want:\n%s\ngot:\n%s", tc.exp, got)
+			}
+		})
+	}
+}
+
 func TestPrintfNoDebugBanner(t *testing.T) {
 	out := internal.CaptureOutput(func() {
 		dlg.Printf("different %s message", "test")
@@ -65,6 +495,151 @@ func TestSetOutput(t *testing.T) {
 	}
 }
 
+func TestRegionWriteTo(t *testing.T) {
+	var out, sink bytes.Buffer
+
+	dlg.SetOutput(&out)
+	defer dlg.SetOutput(os.Stderr)
+
+	r := dlg.BeginRegion("sink", dlg.WriteTo(&sink))
+	dlg.Printf("inside region")
+	r.End()
+	dlg.Printf("outside region")
+
+	if got := sink.String(); !strings.Contains(got, "inside region") || strings.Contains(got, "outside region") {
+		t.Errorf("Expected only output inside the region in the region writer: Got: %q", got)
+	}
+
+	if got := out.String(); strings.Contains(got, "inside region") || !strings.Contains(got, "outside region") {
+		t.Errorf("Expected only output outside the region in the output writer: Got: %q", got)
+	}
+}
+
+func TestRegionCopyTo(t *testing.T) {
+	var out, sink bytes.Buffer
+
+	dlg.SetOutput(&out)
+	defer dlg.SetOutput(os.Stderr)
+
+	r := dlg.BeginRegion("sink", dlg.CopyTo(&sink))
+	dlg.Printf("inside region")
+	r.End()
+	dlg.Printf("outside region")
+
+	if got := sink.String(); !strings.Contains(got, "inside region") || strings.Contains(got, "outside region") {
+		t.Errorf("Expected only output inside the region in the region writer: Got: %q", got)
+	}
+
+	if got := out.String(); !strings.Contains(got, "inside region") || !strings.Contains(got, "outside region") {
+		t.Errorf("Expected all output in the output writer: Got: %q", got)
+	}
+}
+
+func TestRegionWriteToInnermostWins(t *testing.T) {
+	var outer, inner bytes.Buffer
+
+	o := dlg.BeginRegion("outer", dlg.WriteTo(&outer))
+	i := dlg.BeginRegion("inner", dlg.WriteTo(&inner))
+	dlg.Printf("inner message")
+	i.End()
+	dlg.Printf("outer message")
+	o.End()
+
+	if got := inner.String(); !strings.Contains(got, "inner message") || strings.Contains(got, "outer message") {
+		t.Errorf("Expected only the inner message in the inner region writer: Got: %q", got)
+	}
+
+	if got := outer.String(); strings.Contains(got, "inner message") || !strings.Contains(got, "outer message") {
+		t.Errorf("Expected only the outer message in the outer region writer: Got: %q", got)
+	}
+}
+
+func flushHang(done <-chan struct{}) {
+	<-done
+}
+
+func TestRegionTimeout(t *testing.T) {
+	buf := &safeBuffer{}
+
+	dlg.SetOutput(buf)
+	defer dlg.SetOutput(os.Stderr)
+
+	done := make(chan struct{})
+	time.AfterFunc(200*time.Millisecond, func() { close(done) })
+
+	r := dlg.BeginRegionTimeout("flush", 20*time.Millisecond)
+	flushHang(done)
+	r.End()
+
+	buf.Lock()
+	out := buf.String()
+	buf.Unlock()
+
+	for _, want := range []string{
+		`region "flush" exceeded its deadline of 20ms`,
+		"started at printf_test.go:",
+		"in github.com/vvvvv/dlg/tests/printf_test.TestRegionTimeout",
+		"printf_test.flushHang(",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q: Got: %q", want, out)
+		}
+	}
+}
+
+func TestRegionTimeoutEndedInTime(t *testing.T) {
+	buf := &safeBuffer{}
+
+	dlg.SetOutput(buf)
+	defer dlg.SetOutput(os.Stderr)
+
+	r := dlg.BeginRegionTimeout("flush", 20*time.Millisecond)
+	r.End()
+
+	time.Sleep(60 * time.Millisecond)
+
+	buf.Lock()
+	out := buf.String()
+	buf.Unlock()
+
+	if strings.Contains(out, "exceeded its deadline") {
+		t.Errorf("Expected no deadline warning for a region ended in time: Got: %q", out)
+	}
+}
+
+func TestRegionTimeoutEndedWhileOverdue(t *testing.T) {
+	buf := &safeBuffer{}
+
+	dlg.SetOutput(buf)
+	defer dlg.SetOutput(os.Stderr)
+
+	const n = 100
+	ended := make([]string, n)
+	for i := range n {
+		r := dlg.BeginRegionTimeout(fmt.Sprintf("race%d", i), time.Microsecond)
+		time.Sleep(time.Duration(i%10) * time.Microsecond)
+		r.End()
+
+		buf.Lock()
+		ended[i] = buf.String()
+		buf.Unlock()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	buf.Lock()
+	out := buf.String()
+	buf.Unlock()
+
+	// A warning is either written before End returns or not at all.
+	for i := range n {
+		warning := fmt.Sprintf(`region "race%d" exceeded its deadline`, i)
+		if strings.Contains(out, warning) && !strings.Contains(ended[i], warning) {
+			t.Errorf("Expected no deadline warning after End returned: Got: %q", warning)
+		}
+	}
+}
+
 func TestPrintfConcurrentWriter(t *testing.T) {
 	buf := struct {
 		sync.Mutex
@@ -0,0 +1,99 @@
+//go:build dlg
+
+package regionevents_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vvvvv/dlg"
+	"github.com/vvvvv/dlg/tests/internal"
+)
+
+func namedRegion() {
+	r := dlg.BeginRegion("db")
+	dlg.Printf("query")
+	time.Sleep(time.Millisecond)
+	r.End()
+}
+
+func unnamedRegion() {
+	dlg.StartTrace()
+	dlg.Printf("query")
+	dlg.StopTrace()
+}
+
+func keyedRegion() {
+	dlg.StartTrace("key")
+	dlg.StopTrace("key")
+}
+
+func regionEndedTwice() {
+	r := dlg.BeginRegion("db")
+	r.End()
+	r.End()
+}
+
+func TestRegionEvents(t *testing.T) {
+	const header = `^\d{2}:\d{2}:\d{2} \[[^\]]+\] `
+
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  []string
+	}{
+		{
+			name: "named region enter and exit",
+			fn:   namedRegion,
+			exp: []string{
+				header + `>> region "db" entered at region_events_test\.go:\d+$`,
+				header + `\{db\} region_events_test\.go:\d+: query$`,
+				header + `<< region "db" exited after \d+(\.\d+)?ms$`,
+			},
+		},
+		{
+			name: "unnamed region enter and exit",
+			fn:   unnamedRegion,
+			exp: []string{
+				header + `>> region entered at region_events_test\.go:\d+$`,
+				header + `region_events_test\.go:\d+: query$`,
+				header + `<< region exited after \S+$`,
+			},
+		},
+		{
+			name: "keyed region enter and exit",
+			fn:   keyedRegion,
+			exp: []string{
+				header + `>> region entered at region_events_test\.go:\d+$`,
+				header + `<< region exited after \S+$`,
+			},
+		},
+		{
+			name: "no exit event for regions that are already closed",
+			fn:   regionEndedTwice,
+			exp: []string{
+				header + `>> region "db" entered at region_events_test\.go:\d+$`,
+				header + `<< region "db" exited after \S+$`,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(tc.fn)
+			lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+
+			if len(lines) != len(tc.exp) {
+				t.Fatalf("Testcase must contain all output; expected: %v ; got: %v\n%s", len(tc.exp), len(lines), out)
+			}
+
+			for i, exp := range tc.exp {
+				if !regexp.MustCompile(exp).MatchString(lines[i]) {
+					t.Errorf("Mismatch: want: %q ; got: %q", exp, lines[i])
+				}
+			}
+		})
+	}
+}
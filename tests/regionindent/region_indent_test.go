@@ -0,0 +1,110 @@
+//go:build dlg
+
+package regionindent_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/vvvvv/dlg"
+	"github.com/vvvvv/dlg/tests/internal"
+)
+
+func handler() {
+	dlg.Printf("request")
+
+	r := dlg.BeginRegion("handler")
+	dlg.Printf("handling")
+	repo()
+	dlg.Printf("handled")
+	r.End()
+
+	dlg.Printf("response")
+}
+
+func repo() {
+	r := dlg.BeginRegion("repo")
+	defer r.End()
+
+	dlg.Printf("query")
+	tx()
+}
+
+func tx() {
+	dlg.StartTrace()
+	defer dlg.StopTrace()
+
+	dlg.Printf("commit")
+}
+
+// nested starts n nested unnamed regions and prints inside the innermost one.
+func nested(n int) {
+	if n == 0 {
+		dlg.Printf("deep")
+		return
+	}
+
+	dlg.StartTrace()
+	defer dlg.StopTrace()
+
+	nested(n - 1)
+}
+
+func TestRegionIndentTree(t *testing.T) {
+	const header = `^\d{2}:\d{2}:\d{2} \[[^\]]+\] `
+
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  []string
+	}{
+		{
+			name: "no indentation outside of regions",
+			fn: func() {
+				dlg.Printf("outside")
+			},
+			exp: []string{
+				header + `region_indent_test\.go:\d+: outside$`,
+			},
+		},
+		{
+			name: "indentation follows region depth",
+			fn:   handler,
+			exp: []string{
+				header + `region_indent_test\.go:\d+: request$`,
+				header + `├─ \{handler\} region_indent_test\.go:\d+: handling$`,
+				header + `│  ├─ \{handler>repo\} region_indent_test\.go:\d+: query$`,
+				header + `│  │  ├─ \{handler>repo\} region_indent_test\.go:\d+: commit$`,
+				header + `├─ \{handler\} region_indent_test\.go:\d+: handled$`,
+				header + `region_indent_test\.go:\d+: response$`,
+			},
+		},
+		{
+			name: "indentation follows region depth however deeply nested",
+			fn: func() {
+				nested(10)
+			},
+			exp: []string{
+				header + strings.Repeat(`│  `, 9) + `├─ region_indent_test\.go:\d+: deep$`,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(tc.fn)
+			lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+
+			if len(lines) != len(tc.exp) {
+				t.Fatalf("Testcase must contain all output; expected: %v ; got: %v\n%s", len(tc.exp), len(lines), out)
+			}
+
+			for i, exp := range tc.exp {
+				if !regexp.MustCompile(exp).MatchString(lines[i]) {
+					t.Errorf("Mismatch: want: %q ; got: %q", exp, lines[i])
+				}
+			}
+		})
+	}
+}
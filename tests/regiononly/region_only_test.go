@@ -0,0 +1,103 @@
+//go:build dlg
+
+package regiononly_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vvvvv/dlg"
+	"github.com/vvvvv/dlg/tests/internal"
+)
+
+func outsideRegion() {
+	dlg.Printf("suppress this")
+}
+
+func insideRegion() {
+	dlg.Printf("suppress this")
+
+	dlg.StartTrace()
+	dlg.Printf("print this")
+	dlg.StopTrace()
+
+	dlg.Printf("suppress this too")
+}
+
+func insideRegionHandle() {
+	r := dlg.BeginRegion("only")
+	nested()
+	r.End()
+
+	nested()
+}
+
+func nested() {
+	dlg.Printf("print nested")
+}
+
+func insideContextRegion() {
+	ctx := dlg.WithTrace(context.Background())
+	dlg.PrintfContext(ctx, "print this")
+	dlg.PrintfContext(context.Background(), "suppress this")
+}
+
+func TestLazyNotEvaluatedOutsideRegion(t *testing.T) {
+	calls := 0
+	out := internal.CaptureOutput(func() {
+		dlg.Printf("suppress this: %v", dlg.Lazy(func() int {
+			calls++
+			return calls
+		}))
+	})
+
+	if out != "" || calls != 0 {
+		t.Errorf("Expected suppressed Printf not to evaluate lazy arguments: calls: %v ; output: %q", calls, out)
+	}
+}
+
+func TestPrintfOnlyInRegion(t *testing.T) {
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  []string
+	}{
+		{
+			name: "suppress output outside of regions",
+			fn:   outsideRegion,
+			exp:  nil,
+		},
+		{
+			name: "print inside regions",
+			fn:   insideRegion,
+			exp:  []string{"print this"},
+		},
+		{
+			name: "print in functions called inside regions",
+			fn:   insideRegionHandle,
+			exp:  []string{"print nested"},
+		},
+		{
+			name: "print inside context regions",
+			fn:   insideContextRegion,
+			exp:  []string{"print this"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(tc.fn)
+			lines := internal.ParseLines([]byte(out))
+
+			if len(lines) != len(tc.exp) {
+				t.Fatalf("Testcase must contain all output; expected: %v ; got: %v\n%s", len(tc.exp), len(lines), out)
+			}
+
+			for i := 0; i < len(tc.exp); i++ {
+				if got := lines[i]; tc.exp[i] != got.Line() || got.HasTrace() {
+					t.Errorf("Mismatch: want: %q ; got: %q (stacktrace: %v)", tc.exp[i], got.Line(), got.HasTrace())
+				}
+			}
+		})
+	}
+}
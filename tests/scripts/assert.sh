@@ -107,17 +107,57 @@ cat > main.go <<END
 package main
 
 import (
+  "context"
   "fmt"
   "os"
+  "time"
   "github.com/vvvvv/dlg"
 )
 
+//go:noinline
+func lazyExpensive() string {
+  return "evaluated"
+}
+
+//go:noinline
+func debugOnly() {
+  fmt.Println("debug only")
+}
+
 func main(){
   fmt.Println("${test_str}")
+  dlg.TracePackage()
   dlg.StartTrace()
   dlg.Printf("message from dlg")
+  dlg.Helper()
+  dlg.PrintfDepth(0, "message from dlg")
+  dlg.Printf("lazy: %v", dlg.Lazy(lazyExpensive))
+  if dlg.Enabled {
+    debugOnly()
+  }
+  dlg.Do(debugOnly)
+  dlg.Do(func() { debugOnly() })
+  dlg.Dump(struct{ A int }{1}, "dump")
+  dlg.Diff(struct{ A int }{1}, struct{ A int }{2})
+  dlg.Printf("lazy closure: %s", dlg.Lazy(func() string { return lazyExpensive() + "!" }))
+  n := dlg.Value(41) + 1
+  n = dlg.LabeledValue("n", n)
+  _ = n
   dlg.StopTrace()
+  opts := append([]dlg.RegionOption{dlg.BindGoroutine()}, nil)
+  if opts[1] != nil {
+    return
+  }
+  r := dlg.BeginRegion("region", opts...)
+  dlg.Printf("message from region")
+  r.End()
+  t := dlg.BeginRegionTimeout("timeout", time.Second, dlg.WriteTo(os.Stdout))
+  t.End()
+  ctx := dlg.WithTrace(context.Background())
+  dlg.PrintfContext(ctx, "message from context")
   dlg.SetOutput(os.Stdout)
+  _ = dlg.ActiveRegions()
+  dlg.Close()
 }
 
 END
@@ -146,9 +186,23 @@ fi
 
 _test_header "if dlg API is not in compiled output when build without dlg tag"
 go tool objdump "${bin_name}" 2>/dev/null 1> objdump
-if grep --quiet 'dlg.Printf' 'objdump'; then
+if grep --quiet -E 'dlg\.(Printf|BeginRegion|Region|WithTrace|ActiveRegions|Close|WriteTo|TracePackage|Helper|Value|LabeledValue|Lazy|Do|Dump|Diff)' 'objdump'; then
 # if ! go tool objdump "${bin_name}" | grep --quiet 'main'; then
-  _test_failed "expected binary to not contain any reference to dlg.Printf but got:" "$(grep -A2 -B2 'dlg.Printf' 'objdump' )"
+  _test_failed "expected binary to not contain any reference to the dlg API but got:" "$(grep -E -A2 -B2 'dlg\.(Printf|BeginRegion|Region|WithTrace|ActiveRegions|Close|WriteTo|TracePackage|Helper|Value|LabeledValue|Lazy|Do|Dump|Diff)' 'objdump' )"
+else
+  _test_ok
+fi
+
+_test_header "if lazy arguments are not in compiled output when build without dlg tag"
+if grep --quiet 'main\.lazyExpensive' 'objdump'; then
+  _test_failed "expected binary to not contain any reference to lazy arguments but got:" "$(grep -A2 -B2 'main\.lazyExpensive' 'objdump' )"
+else
+  _test_ok
+fi
+
+_test_header "if debug-only code is not in compiled output when build without dlg tag"
+if grep --quiet 'main\.debugOnly' 'objdump'; then
+  _test_failed "expected binary to not contain any reference to debug-only code but got:" "$(grep -A2 -B2 'main\.debugOnly' 'objdump' )"
 else
   _test_ok
 fi
@@ -165,4 +219,37 @@ else
   _test_ok
 fi
 
+_test_header "if lazy arguments are evaluated when build with dlg"
+if ! grep --quiet 'lazy: evaluated' <<<"${test_output}" || ! grep --quiet 'lazy closure: evaluated!' <<<"${test_output}"; then
+  _test_failed "expected lazy arguments in output but got:" "${test_output}"
+else
+  _test_ok
+fi
+
+_test_header "if debug-only code runs when build with dlg"
+if [[ "$(grep --count 'debug only' <<<"${test_output}")" -ne 3 ]]; then
+  _test_failed "expected debug-only code to run 3 times but got:" "${test_output}"
+else
+  _test_ok
+fi
+
+_test_header "if value expressions are printed when build with dlg"
+if ! grep --quiet -E ': 41 = 41$' <<<"${test_output}"; then
+  _test_failed "expected the expression of dlg.Value in output but got:" "${test_output}"
+else
+  _test_ok
+fi
+
+# Delete binary to recompile without access to the source files
+rm "${bin_name}"
+
+_test_header "if values are printed without their expression when build with dlg and -trimpath"
+go_build_out="$(go build -trimpath -tags dlg -o "${bin_name}" 2>&1)"
+test_output="$(./${bin_name} 2>&1)"
+if [[ "$?" -ne 0 ]] || ! grep --quiet -E ': 41$' <<<"${test_output}"; then
+  _test_failed "expected only the value of dlg.Value in output but got:" "${go_build_out}${test_output}"
+else
+  _test_ok
+fi
+
 _test_synopses 
@@ -4,6 +4,7 @@ package dlg_test_stacktrace_always
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/vvvvv/dlg"
@@ -36,6 +37,31 @@ func TestPrintfStackTraceAlways(t *testing.T) {
 	}
 }
 
+// logHelper is a wrapper around dlg.Printf marked as helper.
+func logHelper(f string, v ...any) {
+	dlg.Helper()
+	dlg.Printf(f, v...)
+}
+
+func TestPrintfStackTraceSkipsHelpers(t *testing.T) {
+	out := internal.CaptureOutput(func() {
+		logHelper("test message")
+	})
+
+	lines := internal.ParseLines([]byte(out))
+	if len(lines) != 1 || !lines[0].HasTrace() {
+		t.Fatalf("Expected a single line with stack trace: %q", out)
+	}
+
+	if strings.Contains(out, "logHelper") {
+		t.Errorf("Expected the stack trace to skip the helper: %q", out)
+	}
+
+	if !strings.Contains(out, "TestPrintfStackTraceSkipsHelpers.func1()") {
+		t.Errorf("Expected the stack trace to start at the caller of the helper: %q", out)
+	}
+}
+
 func BenchmarkPrintfTraceAlways16(b *testing.B) {
 	var buf bytes.Buffer
 	dlg.SetOutput(&buf)
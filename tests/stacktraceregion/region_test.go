@@ -4,7 +4,13 @@ package stacktraceregion_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/vvvvv/dlg"
@@ -170,6 +176,17 @@ func stopTraceNoKeyStopsOnlyScopeRegion() {
 	dlg.Printf("don't trace this")
 }
 
+func emptyKeyStartsUnkeyedRegion() {
+	keys := []any{}
+	dlg.StartTrace(keys...)
+
+	dlg.Printf("trace this")
+
+	dlg.StopTrace(keys...)
+
+	dlg.Printf("don't trace this")
+}
+
 func startTracingRegionOrPrintf(start bool, key any) {
 	if start {
 		dlg.StartTrace(key)
@@ -198,6 +215,217 @@ func tracingRegionAcrossGoroutines() {
 	startTracingRegionOrPrintf(false, nil)
 }
 
+func regionHandle() {
+	r := dlg.BeginRegion("handle")
+	dlg.Printf("trace this")
+	r.End()
+
+	dlg.Printf("don't trace this")
+}
+
+func regionHandleEndOutOfOrder() {
+	outer := dlg.BeginRegion("outer")
+	inner := dlg.BeginRegion("inner")
+
+	outer.End()
+	dlg.Printf("trace this")
+
+	inner.End()
+	dlg.Printf("don't trace this")
+}
+
+func regionHandleEndFromOtherScope() {
+	r := dlg.BeginRegion("handle")
+
+	f := func() {
+		dlg.Printf("trace this")
+		r.End()
+	}
+
+	f()
+
+	dlg.Printf("don't trace this")
+}
+
+func regionHandleIgnoresStopTrace() {
+	r := dlg.BeginRegion("handle")
+
+	dlg.StopTrace()
+	dlg.Printf("trace this")
+
+	r.End()
+	r.End()
+	dlg.Printf("don't trace this")
+}
+
+func regionHandleZeroValue() {
+	var r dlg.Region
+	r.End()
+
+	dlg.Printf("don't trace this")
+}
+
+// boundRegionFn optionally begins a region bound to the calling goroutine, waits and prints msg.
+func boundRegionFn(bind bool, msg string, wait func()) {
+	var r dlg.Region
+	if bind {
+		r = dlg.BeginRegion("bound", dlg.BindGoroutine())
+	}
+
+	wait()
+	dlg.Printf(msg)
+	r.End()
+}
+
+func goroutineBoundRegion() {
+	started := make(chan struct{})
+	printed := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		boundRegionFn(true, "trace this", func() {
+			close(started)
+			<-printed
+		})
+		close(done)
+	}()
+
+	<-started
+	// Same function but on another goroutine
+	boundRegionFn(false, "don't trace this", func() {})
+	close(printed)
+	<-done
+}
+
+func goroutineTreeRegion() {
+	r := dlg.BeginRegion("tree", dlg.BindGoroutineTree())
+
+	child := make(chan struct{})
+	go func() {
+		dlg.Printf("trace this")
+		close(child)
+	}()
+	<-child
+
+	grandchild := make(chan struct{})
+	go func() {
+		go func() {
+			dlg.Printf("don't trace this")
+			close(grandchild)
+		}()
+	}()
+	<-grandchild
+
+	dlg.Printf("trace this too")
+	r.End()
+
+	dlg.Printf("don't trace this either")
+}
+
+func contextRegion() {
+	ctx := dlg.WithTrace(context.Background())
+
+	dlg.PrintfContext(ctx, "trace this")
+	dlg.PrintfContext(context.Background(), "don't trace this")
+	dlg.Printf("don't trace this either")
+}
+
+func contextRegionAcrossGoroutines() {
+	ctx, cancel := context.WithCancel(dlg.WithTrace(context.Background()))
+	defer cancel()
+
+	work := make(chan context.Context)
+	done := make(chan struct{})
+
+	go func() {
+		for ctx := range work {
+			dlg.PrintfContext(ctx, "trace this")
+		}
+		dlg.PrintfContext(context.Background(), "don't trace this")
+		close(done)
+	}()
+
+	work <- ctx
+	close(work)
+	<-done
+}
+
+// recursiveRegion starts a region on the outermost level of the recursion only.
+// StopTrace on a deeper level must not close it.
+func recursiveRegion(n int) {
+	if n == 2 {
+		dlg.StartTrace()
+	}
+
+	if n > 0 {
+		recursiveRegion(n - 1)
+	} else {
+		dlg.StopTrace()
+	}
+
+	dlg.Printf("trace this")
+
+	if n == 2 {
+		dlg.StopTrace()
+		dlg.Printf("don't trace this")
+	}
+}
+
+type worker struct {
+	next *worker
+}
+
+func (w *worker) run() {
+	if w.next == nil {
+		dlg.StopTrace()
+		dlg.Printf("trace this")
+		return
+	}
+
+	dlg.StartTrace()
+
+	run := w.next.run
+	run()
+
+	dlg.Printf("trace this too")
+
+	dlg.StopTrace()
+	dlg.Printf("don't trace this")
+}
+
+func methodValueRegion() {
+	w := &worker{next: &worker{}}
+	w.run()
+}
+
+// genericRegion instantiated with different pointer types shares a single implementation.
+func genericRegion[T any](v T, next func()) {
+	if next == nil {
+		dlg.StopTrace()
+		dlg.Printf("trace this")
+		return
+	}
+
+	dlg.StartTrace()
+
+	next()
+
+	dlg.Printf("trace this too")
+
+	dlg.StopTrace()
+	dlg.Printf("don't trace this")
+}
+
+func genericInstantiationsRegion() {
+	var (
+		i int
+		s string
+	)
+	genericRegion(&i, func() {
+		genericRegion(&s, nil)
+	})
+}
+
 func TestPrintfStackTraceRegion(t *testing.T) {
 	type exp struct {
 		line  string
@@ -353,6 +581,18 @@ func TestPrintfStackTraceRegion(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "treat an empty key as no key",
+			fn:   emptyKeyStartsUnkeyedRegion,
+			exp: []exp{
+				{
+					"trace this", true,
+				},
+				{
+					"don't trace this", false,
+				},
+			},
+		},
 		{
 			name: "stop tracing active region with key only when called from the same scope",
 			fn:   stopTraceNoKeyStopsOnlyScopeRegion,
@@ -380,6 +620,110 @@ func TestPrintfStackTraceRegion(t *testing.T) {
 				{"start region or printf", false},
 			},
 		},
+		{
+			name: "trace in region handle until end",
+			fn:   regionHandle,
+			exp: []exp{
+				{"trace this", true},
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "region handles close exactly their own region",
+			fn:   regionHandleEndOutOfOrder,
+			exp: []exp{
+				{"trace this", true},
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "region handle can be ended from another scope",
+			fn:   regionHandleEndFromOtherScope,
+			exp: []exp{
+				{"trace this", true},
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "region handle is not closed by StopTrace",
+			fn:   regionHandleIgnoresStopTrace,
+			exp: []exp{
+				{"trace this", true},
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "region bound to a goroutine doesn't trace other goroutines",
+			fn:   goroutineBoundRegion,
+			exp: []exp{
+				{"don't trace this", false},
+				{"trace this", true},
+			},
+		},
+		{
+			name: "region bound to a goroutine tree traces spawned goroutines",
+			fn:   goroutineTreeRegion,
+			exp: []exp{
+				{"trace this", true},
+				{"don't trace this", false},
+				{"trace this too", true},
+				{"don't trace this either", false},
+			},
+		},
+		{
+			name: "trace context carrying a region",
+			fn:   contextRegion,
+			exp: []exp{
+				{"trace this", true},
+				{"don't trace this", false},
+				{"don't trace this either", false},
+			},
+		},
+		{
+			name: "context region follows the context across goroutines",
+			fn:   contextRegionAcrossGoroutines,
+			exp: []exp{
+				{"trace this", true},
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "StopTrace in a deeper level of a recursion doesn't close the outer region",
+			fn: func() {
+				recursiveRegion(2)
+			},
+			exp: []exp{
+				{"trace this", true},
+				{"trace this", true},
+				{"trace this", true},
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "StopTrace in a method called on another receiver doesn't close the region",
+			fn:   methodValueRegion,
+			exp: []exp{
+				{"trace this", true},
+				{"trace this too", true},
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "StopTrace in another instantiation of a generic function doesn't close the region",
+			fn:   genericInstantiationsRegion,
+			exp: []exp{
+				{"trace this", true},
+				{"trace this too", true},
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "ending the zero region is a no-op",
+			fn:   regionHandleZeroValue,
+			exp: []exp{
+				{"don't trace this", false},
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -409,6 +753,319 @@ func TestPrintfStackTraceRegion(t *testing.T) {
 	}
 }
 
+func namedRegionsNested() {
+	checkout := dlg.BeginRegion("checkout")
+	dlg.Printf("in checkout")
+
+	payment := dlg.BeginRegion("payment")
+	dlg.Printf("in payment")
+	payment.End()
+
+	checkout.End()
+	dlg.Printf("outside")
+}
+
+func namedRegionsAcrossFunctions() {
+	outer := dlg.BeginRegion("outer")
+	func() {
+		inner := dlg.BeginRegion("inner")
+		dlg.Printf("in inner")
+		inner.End()
+	}()
+	outer.End()
+}
+
+func namedRegionsSkipUnnamed() {
+	r := dlg.BeginRegion("named")
+	dlg.StartTrace()
+	dlg.Printf("in named")
+	dlg.StopTrace()
+	r.End()
+
+	dlg.StartTrace()
+	dlg.Printf("in unnamed")
+	dlg.StopTrace()
+}
+
+func namedRegionsDeeplyNested() {
+	var regions []dlg.Region
+	for i := 0; i < 10; i++ {
+		regions = append(regions, dlg.BeginRegion("r"+strconv.Itoa(i)))
+	}
+	dlg.Printf("in r9")
+	for i := len(regions) - 1; i >= 0; i-- {
+		regions[i].End()
+	}
+}
+
+func TestPrintfRegionNames(t *testing.T) {
+	type exp struct {
+		line    string
+		regions []string
+	}
+
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  []exp
+	}{
+		{
+			name: "show nested region names outermost first",
+			fn:   namedRegionsNested,
+			exp: []exp{
+				{"in checkout", []string{"checkout"}},
+				{"in payment", []string{"checkout", "payment"}},
+				{"outside", nil},
+			},
+		},
+		{
+			name: "show names of regions started in calling functions",
+			fn:   namedRegionsAcrossFunctions,
+			exp: []exp{
+				{"in inner", []string{"outer", "inner"}},
+			},
+		},
+		{
+			name: "don't show unnamed regions",
+			fn:   namedRegionsSkipUnnamed,
+			exp: []exp{
+				{"in named", []string{"named"}},
+				{"in unnamed", nil},
+			},
+		},
+		{
+			name: "show names of all regions however deeply nested",
+			fn:   namedRegionsDeeplyNested,
+			exp: []exp{
+				{"in r9", []string{"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9"}},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(tc.fn)
+			lines := internal.ParseLines([]byte(out))
+
+			if len(lines) != len(tc.exp) {
+				t.Fatalf("Testcase must contain all output; expected: %v ; got: %v\n%s", len(tc.exp), len(lines), out)
+			}
+
+			for i := 0; i < len(tc.exp); i++ {
+				want := tc.exp[i]
+				got := lines[i]
+
+				if want.line != got.Line() || !slices.Equal(want.regions, got.Regions()) {
+					t.Errorf("Mismatch: want: %q (regions: %v) ; got: %q (regions: %v)", want.line, want.regions, got.Line(), got.Regions())
+				}
+			}
+		})
+	}
+}
+
+func policyNever() {
+	r := dlg.BeginRegion("never", dlg.TraceNever())
+	dlg.Printf("don't trace this")
+	r.End()
+
+	dlg.StartTrace()
+	dlg.Printf("trace this")
+	dlg.StopTrace()
+}
+
+func policyOnError() {
+	r := dlg.BeginRegion("error", dlg.TraceOnError())
+	dlg.Printf("don't trace this")
+	dlg.Printf("trace %v", fmt.Errorf("this error"))
+	r.End()
+}
+
+func policyFirst() {
+	r := dlg.BeginRegion("first", dlg.TraceFirst(2))
+	for i := 0; i < 3; i++ {
+		dlg.Printf("call %v", i)
+	}
+	r.End()
+}
+
+func policyInnermostWins() {
+	outer := dlg.BeginRegion("outer", dlg.TraceNever())
+	dlg.Printf("don't trace this")
+
+	inner := dlg.BeginRegion("inner", dlg.TraceAlways())
+	dlg.Printf("trace this")
+	inner.End()
+
+	dlg.Printf("don't trace this either")
+	outer.End()
+}
+
+func policyOverridesUnsetPolicy() {
+	outer := dlg.BeginRegion("outer", dlg.TraceNever())
+	inner := dlg.BeginRegion("inner")
+	dlg.Printf("don't trace this")
+	inner.End()
+	outer.End()
+}
+
+func TestPrintfStackTraceRegionPolicy(t *testing.T) {
+	type exp struct {
+		line  string
+		trace bool
+	}
+
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  []exp
+	}{
+		{
+			name: "never trace overrides DLG_STACKTRACE",
+			fn:   policyNever,
+			exp: []exp{
+				{"don't trace this", false},
+				{"trace this", true},
+			},
+		},
+		{
+			name: "trace on error overrides DLG_STACKTRACE",
+			fn:   policyOnError,
+			exp: []exp{
+				{"don't trace this", false},
+				{"trace this error", true},
+			},
+		},
+		{
+			name: "trace only the first n calls",
+			fn:   policyFirst,
+			exp: []exp{
+				{"call 0", true},
+				{"call 1", true},
+				{"call 2", false},
+			},
+		},
+		{
+			name: "innermost region policy wins",
+			fn:   policyInnermostWins,
+			exp: []exp{
+				{"don't trace this", false},
+				{"trace this", true},
+				{"don't trace this either", false},
+			},
+		},
+		{
+			name: "regions without policy inherit the enclosing policy",
+			fn:   policyOverridesUnsetPolicy,
+			exp: []exp{
+				{"don't trace this", false},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(tc.fn)
+			lines := internal.ParseLines([]byte(out))
+
+			if len(lines) != len(tc.exp) {
+				t.Fatalf("Testcase must contain all output; expected: %v ; got: %v\n%s", len(tc.exp), len(lines), out)
+			}
+
+			for i := 0; i < len(tc.exp); i++ {
+				want := tc.exp[i]
+				got := lines[i]
+
+				if want.line != got.Line() || want.trace != got.HasTrace() {
+					t.Errorf("Mismatch: want: %q (stacktrace: %v) ; got: %q (stacktrace: %v)", want.line, want.trace, got.Line(), got.HasTrace())
+				}
+			}
+		})
+	}
+}
+
+func TestStartTraceRejectsKeysThatAreNotComparable(t *testing.T) {
+	out := internal.CaptureOutput(func() {
+		dlg.StartTrace(map[string]int{"a": 1})
+		dlg.Printf("don't trace this")
+		dlg.StopTrace(map[string]int{"a": 1})
+	})
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Testcase must contain all output; expected: 3 ; got: %v\n%s", len(lines), out)
+	}
+
+	exp := []string{
+		`dlg: StartTrace\(map\[string\]int\{"a":1\}\) ignored, key is not comparable \(called at region_test\.go:\d+\)$`,
+		`region_test\.go:\d+: don't trace this$`,
+		`dlg: StopTrace\(map\[string\]int\{"a":1\}\) ignored, key is not comparable \(called at region_test\.go:\d+\)$`,
+	}
+	for i := range exp {
+		if !regexp.MustCompile(exp[i]).MatchString(lines[i]) {
+			t.Errorf("Mismatch: want: %q ; got: %q", exp[i], lines[i])
+		}
+	}
+
+	if regions := dlg.ActiveRegions(); len(regions) != 0 {
+		t.Errorf("Expected no open regions but got: %+v", regions)
+	}
+}
+
+func TestActiveRegions(t *testing.T) {
+	if regions := dlg.ActiveRegions(); len(regions) != 0 {
+		t.Fatalf("Expected no active regions but got: %+v", regions)
+	}
+
+	r := dlg.BeginRegion("leak")
+	dlg.StartTrace()
+
+	regions := dlg.ActiveRegions()
+	if len(regions) != 2 {
+		t.Fatalf("Expected 2 active regions but got: %+v", regions)
+	}
+
+	if got := regions[0]; got.Name != "leak" || !strings.HasSuffix(got.File, "region_test.go") || got.Line == 0 || got.Age <= 0 ||
+		got.Function != "github.com/vvvvv/dlg/tests/stacktraceregion_test.TestActiveRegions" {
+		t.Errorf("Mismatch: got: %+v", got)
+	}
+
+	if got := regions[1]; got.Name != "" || regions[1].Line <= regions[0].Line {
+		t.Errorf("Mismatch: got: %+v", got)
+	}
+
+	dlg.StopTrace()
+	r.End()
+
+	if regions := dlg.ActiveRegions(); len(regions) != 0 {
+		t.Errorf("Expected no active regions but got: %+v", regions)
+	}
+}
+
+func TestCloseReportsUnclosedRegions(t *testing.T) {
+	var buf bytes.Buffer
+	dlg.SetOutput(&buf)
+	defer dlg.SetOutput(os.Stderr)
+
+	dlg.Close()
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no report without open regions but got: %q", buf.String())
+	}
+
+	r := dlg.BeginRegion("leak")
+	dlg.StartTrace()
+	dlg.Close()
+	dlg.StopTrace()
+	r.End()
+
+	want := regexp.MustCompile(`^\d{2}:\d{2}:\d{2} \[[^\]]+\] 2 unclosed regions:
+  "leak" started at region_test\.go:\d+ in \S+\.TestCloseReportsUnclosedRegions \S+ ago
+  region started at region_test\.go:\d+ in \S+\.TestCloseReportsUnclosedRegions \S+ ago
+$`)
+	if got := buf.String(); !want.MatchString(got) {
+		t.Errorf("Mismatch: got: %q", got)
+	}
+}
+
 func BenchmarkPrintfWithRegion16(b *testing.B) {
 	var buf bytes.Buffer
 	dlg.SetOutput(&buf)
@@ -465,6 +1122,20 @@ func BenchmarkPrintfWithRegionStartStop64(b *testing.B) {
 	}
 }
 
+func BenchmarkPrintfWithRegionBeginEnd16(b *testing.B) {
+	var buf bytes.Buffer
+	dlg.SetOutput(&buf)
+
+	s := internal.RandomStrings(16)
+
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		r := dlg.BeginRegion("bench")
+		dlg.Printf(s[i%len(s)])
+		r.End()
+	}
+}
+
 func BenchmarkPrintfWithRegionStartStopWithKey16(b *testing.B) {
 	var buf bytes.Buffer
 	dlg.SetOutput(&buf)
@@ -494,3 +1165,121 @@ func BenchmarkPrintfWithRegionStartStopWithKey64(b *testing.B) {
 		dlg.StopTrace(key)
 	}
 }
+
+// benchmarkStopTraceWithKeyOpen measures stopping a keyed region while n other keyed regions are open.
+func benchmarkStopTraceWithKeyOpen(b *testing.B, n int) {
+	for i := 0; i < n; i++ {
+		startTracingRegionOrPrintf(true, i)
+	}
+	defer func() {
+		for i := 0; i < n; i++ {
+			dlg.StopTrace(i)
+		}
+	}()
+
+	key := "key"
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		dlg.StartTrace(key)
+		b.StartTimer()
+
+		dlg.StopTrace(key)
+	}
+}
+
+func BenchmarkStopTraceWithKey16Open(b *testing.B) {
+	benchmarkStopTraceWithKeyOpen(b, 16)
+}
+
+func BenchmarkStopTraceWithKey256Open(b *testing.B) {
+	benchmarkStopTraceWithKeyOpen(b, 256)
+}
+
+func BenchmarkStopTraceWithKey1024Open(b *testing.B) {
+	benchmarkStopTraceWithKeyOpen(b, 1024)
+}
+
+// BenchmarkStopTraceWithKeyOldest256Open stops the oldest of 256 open keyed regions, which is the worst case for a linear search.
+func BenchmarkStopTraceWithKeyOldest256Open(b *testing.B) {
+	const n = 256
+	for i := 0; i < n; i++ {
+		startTracingRegionOrPrintf(true, i)
+	}
+	defer func() {
+		for i := 0; i < n; i++ {
+			dlg.StopTrace(i)
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dlg.StopTrace(0)
+
+		b.StopTimer()
+		startTracingRegionOrPrintf(true, 0)
+		b.StartTimer()
+	}
+}
+
+// recurse calls fn at a stack depth of n frames.
+func recurse(n int, fn func()) {
+	if n == 0 {
+		fn()
+		return
+	}
+	recurse(n-1, fn)
+}
+
+func BenchmarkPrintfOutsideRegion16(b *testing.B) {
+	var buf bytes.Buffer
+	dlg.SetOutput(&buf)
+
+	s := internal.RandomStrings(16)
+	key := "outside"
+
+	// The region stays open but the benchmark loop isn't part of it
+	startTracingRegionOrPrintf(true, key)
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		dlg.Printf(s[i%len(s)])
+	}
+	dlg.StopTrace(key)
+}
+
+func BenchmarkPrintfOutsideRegionDeepStack16(b *testing.B) {
+	var buf bytes.Buffer
+	dlg.SetOutput(&buf)
+
+	s := internal.RandomStrings(16)
+	key := "outside"
+
+	startTracingRegionOrPrintf(true, key)
+	recurse(48, func() {
+		for i := 0; i < b.N; i++ {
+			buf.Reset()
+			dlg.Printf(s[i%len(s)])
+		}
+	})
+	dlg.StopTrace(key)
+}
+
+func BenchmarkPrintfOutsideManyRegions16(b *testing.B) {
+	var buf bytes.Buffer
+	dlg.SetOutput(&buf)
+
+	s := internal.RandomStrings(16)
+
+	const regions = 64
+	for i := 0; i < regions; i++ {
+		startTracingRegionOrPrintf(true, i)
+	}
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		dlg.Printf(s[i%len(s)])
+	}
+	for i := 0; i < regions; i++ {
+		dlg.StopTrace(i)
+	}
+}
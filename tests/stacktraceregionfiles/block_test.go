@@ -0,0 +1,17 @@
+//go:build dlg
+
+package stacktraceregionfiles_test
+
+import (
+	"github.com/vvvvv/dlg"
+)
+
+// Lines 13-15 of this file are declared as region via DLG_REGION_FILES (see Makefile).
+// Don't move the calls below without updating the range.
+func block(fn func()) {
+	dlg.Printf("don't trace this")
+	dlg.Printf("trace this")
+	fn()
+	dlg.Printf("trace this too")
+	dlg.Printf("don't trace this either")
+}
@@ -0,0 +1,88 @@
+//go:build dlg
+
+package stacktraceregionfiles_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/vvvvv/dlg"
+	"github.com/vvvvv/dlg/tests/internal"
+)
+
+func TestPrintfStackTraceRegionFiles(t *testing.T) {
+	type exp struct {
+		line  string
+		trace bool
+	}
+
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  []exp
+	}{
+		{
+			name: "don't trace files not listed in DLG_REGION_FILES",
+			fn: func() {
+				dlg.Printf("don't trace this")
+			},
+			exp: []exp{
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "trace files listed in DLG_REGION_FILES",
+			fn:   tracedFile,
+			exp: []exp{
+				{"trace this", true},
+			},
+		},
+		{
+			name: "trace functions called from files listed in DLG_REGION_FILES",
+			fn: func() {
+				tracedFileCalling(func() {
+					dlg.Printf("trace this")
+				})
+			},
+			exp: []exp{
+				{"trace this", true},
+			},
+		},
+		{
+			name: "trace only the line range listed in DLG_REGION_FILES",
+			fn: func() {
+				block(func() {
+					dlg.Printf("trace this as well")
+				})
+			},
+			exp: []exp{
+				{"don't trace this", false},
+				{"trace this", true},
+				{"trace this as well", true},
+				{"trace this too", true},
+				{"don't trace this either", false},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(tc.fn)
+			lines := internal.ParseLines([]byte(out))
+
+			if len(lines) != len(tc.exp) {
+				fmt.Printf("OUT: %v\n", out)
+				t.Fatalf("Testcase must contain all output; expected: %v ; got: %v", len(tc.exp), len(lines))
+			}
+
+			for i := 0; i < len(tc.exp); i++ {
+				want := tc.exp[i]
+				got := lines[i]
+
+				if want.line != got.Line() || want.trace != got.HasTrace() {
+					t.Errorf("Mismatch: want: %q (stacktrace: %v) ; got: %q (stacktrace: %v)", want.line, want.trace, got.Line(), got.HasTrace())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+//go:build dlg
+
+package stacktraceregionfiles_test
+
+import (
+	"github.com/vvvvv/dlg"
+)
+
+// Every line of this file is declared as region via DLG_REGION_FILES (see Makefile).
+
+func tracedFile() {
+	dlg.Printf("trace this")
+}
+
+func tracedFileCalling(fn func()) {
+	fn()
+}
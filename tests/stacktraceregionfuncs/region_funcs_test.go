@@ -0,0 +1,118 @@
+//go:build dlg
+
+package stacktraceregionfuncs_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vvvvv/dlg"
+	"github.com/vvvvv/dlg/tests/internal"
+)
+
+// Functions prefixed with "traced" are declared as tracing regions via DLG_REGION (see Makefile).
+
+func tracedFn() {
+	dlg.Printf("trace this")
+}
+
+func tracedCallsUntraced() {
+	untracedFn("trace this too")
+}
+
+func untracedFn(msg string) {
+	dlg.Printf(msg)
+}
+
+func untracedCallsTraced() {
+	dlg.Printf("don't trace this")
+	tracedFn()
+}
+
+func tracedClosure() {
+	func() {
+		dlg.Printf("trace closure")
+	}()
+}
+
+func TestPrintfStackTraceRegionFuncs(t *testing.T) {
+	type exp struct {
+		line  string
+		trace bool
+	}
+
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  []exp
+	}{
+		{
+			name: "don't trace functions not matching DLG_REGION",
+			fn:   func() { untracedFn("don't trace this") },
+			exp: []exp{
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "trace functions matching DLG_REGION",
+			fn:   tracedFn,
+			exp: []exp{
+				{"trace this", true},
+			},
+		},
+		{
+			name: "trace functions called by functions matching DLG_REGION",
+			fn:   tracedCallsUntraced,
+			exp: []exp{
+				{"trace this too", true},
+			},
+		},
+		{
+			name: "trace only inside functions matching DLG_REGION",
+			fn:   untracedCallsTraced,
+			exp: []exp{
+				{"don't trace this", false},
+				{"trace this", true},
+			},
+		},
+		{
+			name: "trace closures of functions matching DLG_REGION",
+			fn:   tracedClosure,
+			exp: []exp{
+				{"trace closure", true},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(tc.fn)
+			lines := internal.ParseLines([]byte(out))
+
+			if len(lines) != len(tc.exp) {
+				t.Fatalf("Testcase must contain all output; expected: %v ; got: %v\n%s", len(tc.exp), len(lines), out)
+			}
+
+			for i := 0; i < len(tc.exp); i++ {
+				want := tc.exp[i]
+				got := lines[i]
+
+				if want.line != got.Line() || want.trace != got.HasTrace() {
+					t.Errorf("Mismatch: want: %q (stacktrace: %v) ; got: %q (stacktrace: %v)", want.line, want.trace, got.Line(), got.HasTrace())
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPrintfRegionFuncs16(b *testing.B) {
+	var buf bytes.Buffer
+	dlg.SetOutput(&buf)
+
+	s := internal.RandomStrings(16)
+
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		untracedFn(s[i%len(s)])
+	}
+}
@@ -0,0 +1,14 @@
+//go:build dlg
+
+package stacktraceregionself
+
+import (
+	"github.com/vvvvv/dlg"
+)
+
+// Every line of this file is declared as region via DLG_REGION_FILES (see Makefile).
+// It shares its name with dlg's own printf.go.
+
+func TracedFile() {
+	dlg.Printf("trace this file")
+}
@@ -0,0 +1,89 @@
+//go:build dlg
+
+package stacktraceregionself_test
+
+import (
+	"testing"
+
+	"github.com/vvvvv/dlg"
+	"github.com/vvvvv/dlg/tests/internal"
+	"github.com/vvvvv/dlg/tests/stacktraceregionself"
+)
+
+// DLG_REGION matches every function of dlg itself as well as functions prefixed with "traced" (see Makefile).
+// DLG_REGION_FILES declares printf.go as region, which is the name of both a file of this package and one of dlg.
+// dlg's own frames must never put a call inside a static region.
+
+func tracedFn() {
+	dlg.Printf("trace this")
+}
+
+func untracedFn() {
+	dlg.Printf("don't trace this")
+}
+
+func untracedValue() {
+	dlg.Value(42)
+}
+
+func TestPrintfStackTraceRegionSelf(t *testing.T) {
+	type exp struct {
+		line  string
+		trace bool
+	}
+
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  []exp
+	}{
+		{
+			name: "don't trace calls matching DLG_REGION only through dlg's own frames",
+			fn:   untracedFn,
+			exp: []exp{
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "don't trace values matching DLG_REGION only through dlg's own frames",
+			fn:   untracedValue,
+			exp: []exp{
+				{"42 = 42", false},
+			},
+		},
+		{
+			name: "trace files matching DLG_REGION_FILES",
+			fn:   stacktraceregionself.TracedFile,
+			exp: []exp{
+				{"trace this file", true},
+			},
+		},
+		{
+			name: "trace functions matching DLG_REGION",
+			fn:   tracedFn,
+			exp: []exp{
+				{"trace this", true},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(tc.fn)
+			lines := internal.ParseLines([]byte(out))
+
+			if len(lines) != len(tc.exp) {
+				t.Fatalf("Testcase must contain all output; expected: %v ; got: %v\n%s", len(tc.exp), len(lines), out)
+			}
+
+			for i := 0; i < len(tc.exp); i++ {
+				want := tc.exp[i]
+				got := lines[i]
+
+				if want.line != got.Line() || want.trace != got.HasTrace() {
+					t.Errorf("Mismatch: want: %q (stacktrace: %v) ; got: %q (stacktrace: %v)", want.line, want.trace, got.Line(), got.HasTrace())
+				}
+			}
+		})
+	}
+}
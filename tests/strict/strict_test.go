@@ -0,0 +1,123 @@
+//go:build dlg
+
+package strict_test
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/vvvvv/dlg"
+)
+
+// recoverMisuse runs fn and returns the value it panicked with formatted as string.
+func recoverMisuse(fn func()) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprint(r)
+		}
+	}()
+	fn()
+	return ""
+}
+
+func stopWithoutRegion() {
+	dlg.StopTrace()
+}
+
+func stopWithUnknownKey() {
+	dlg.StartTrace("foo")
+	defer dlg.StopTrace("foo")
+
+	dlg.StopTrace("bar")
+}
+
+func stopOutsideScope() {
+	dlg.StartTrace("scope")
+	defer dlg.StopTrace("scope")
+
+	func() {
+		dlg.StopTrace()
+	}()
+}
+
+func endTwice() {
+	r := dlg.BeginRegion("twice")
+	r.End()
+	r.End()
+}
+
+func startWithSliceKey() {
+	dlg.StartTrace([]int{1, 2})
+}
+
+func matchingStops() {
+	dlg.StartTrace()
+	dlg.StopTrace()
+
+	dlg.StartTrace("foo")
+	dlg.StopTrace("foo")
+
+	dlg.StartTrace("foo", 1, struct{ id int }{2})
+	dlg.StopTrace("foo", 1, struct{ id int }{2})
+
+	r := dlg.BeginRegion("once")
+	r.End()
+
+	var zero dlg.Region
+	zero.End()
+}
+
+func TestStrictMode(t *testing.T) {
+	const callsite = `\n\tcalled at \S+/strict_test\.go:\d+`
+
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  string
+	}{
+		{
+			name: "panic on StopTrace without open region",
+			fn:   stopWithoutRegion,
+			exp:  `^dlg: StopTrace\(\) called without any open region` + callsite + `\n\tno region is open$`,
+		},
+		{
+			name: "panic on StopTrace with unknown key",
+			fn:   stopWithUnknownKey,
+			exp:  `^dlg: StopTrace\("bar"\) matches no open region` + callsite + `\n\tmost recent open region with key \("foo"\) started at \S+/strict_test\.go:\d+ in \S+\.stopWithUnknownKey$`,
+		},
+		{
+			name: "panic on StopTrace outside of the region scope",
+			fn:   stopOutsideScope,
+			exp:  `^dlg: StopTrace called in \S+\.stopOutsideScope\.func1 which has no open region` + callsite + `\n\tmost recent open region with key \("scope"\) started at \S+/strict_test\.go:\d+ in \S+\.stopOutsideScope$`,
+		},
+		{
+			name: "panic on ending a region twice",
+			fn:   endTwice,
+			exp:  `^dlg: End called on region "twice" which was already closed` + callsite + `\n\tno region is open$`,
+		},
+		{
+			name: "panic on StartTrace with a key that is not comparable",
+			fn:   startWithSliceKey,
+			exp:  `^dlg: StartTrace\(\[\]int\{1, 2\}\) called with a key that is not comparable` + callsite + `\n\tno region is open$`,
+		},
+		{
+			name: "don't panic on correct usage",
+			fn:   matchingStops,
+			exp:  `^$`,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := recoverMisuse(tc.fn)
+			if !regexp.MustCompile(tc.exp).MatchString(got) {
+				t.Errorf("Mismatch: want: %q ; got: %q", tc.exp, got)
+			}
+
+			if regions := dlg.ActiveRegions(); len(regions) != 0 {
+				t.Errorf("Expected all regions to be closed but got: %+v", regions)
+			}
+		})
+	}
+}
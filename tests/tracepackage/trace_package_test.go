@@ -0,0 +1,83 @@
+//go:build dlg
+
+package tracepackage_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/vvvvv/dlg"
+	"github.com/vvvvv/dlg/tests/internal"
+	"github.com/vvvvv/dlg/tests/tracepackage/traced"
+)
+
+func TestTracePackage(t *testing.T) {
+	type exp struct {
+		line  string
+		trace bool
+	}
+
+	tcs := []struct {
+		name string
+		fn   func()
+		exp  []exp
+	}{
+		{
+			name: "don't trace outside of the traced package",
+			fn: func() {
+				dlg.Printf("don't trace this")
+			},
+			exp: []exp{
+				{"don't trace this", false},
+			},
+		},
+		{
+			name: "trace functions of the traced package",
+			fn:   traced.Work,
+			exp: []exp{
+				{"trace this", true},
+			},
+		},
+		{
+			name: "trace methods of the traced package",
+			fn:   (&traced.Service{}).Handle,
+			exp: []exp{
+				{"trace this too", true},
+			},
+		},
+		{
+			name: "trace functions called by the traced package",
+			fn: func() {
+				traced.Run(func() {
+					dlg.Printf("trace this")
+				})
+				dlg.Printf("don't trace this")
+			},
+			exp: []exp{
+				{"trace this", true},
+				{"don't trace this", false},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			out := internal.CaptureOutput(tc.fn)
+			lines := internal.ParseLines([]byte(out))
+
+			if len(lines) != len(tc.exp) {
+				fmt.Printf("OUT: %v\n", out)
+				t.Fatalf("Testcase must contain all output; expected: %v ; got: %v", len(tc.exp), len(lines))
+			}
+
+			for i := 0; i < len(tc.exp); i++ {
+				want := tc.exp[i]
+				got := lines[i]
+
+				if want.line != got.Line() || want.trace != got.HasTrace() {
+					t.Errorf("Mismatch: want: %q (stacktrace: %v) ; got: %q (stacktrace: %v)", want.line, want.trace, got.Line(), got.HasTrace())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+//go:build dlg
+
+// Package traced calls dlg.TracePackage to mark all of its functions as tracing regions.
+package traced
+
+import (
+	"github.com/vvvvv/dlg"
+)
+
+func init() {
+	dlg.TracePackage()
+}
+
+func Work() {
+	dlg.Printf("trace this")
+}
+
+func Run(fn func()) {
+	fn()
+}
+
+type Service struct{}
+
+func (s *Service) Handle() {
+	dlg.Printf("trace this too")
+}
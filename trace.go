@@ -3,16 +3,22 @@
 package dlg
 
 import (
-	"reflect"
+	"context"
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const maxFrames = 64
 
+// Buffers for runtime.Callers
+// Pointers are pooled as putting a slice into a sync.Pool allocates.
 var pcPool = sync.Pool{
-	New: func() any { return make([]uintptr, maxFrames) },
+	New: func() any {
+		pcs := make([]uintptr, maxFrames)
+		return &pcs
+	},
 }
 
 // writeStack appends a formatted stack trace to the provided byte buffer.
@@ -21,26 +27,37 @@ var pcPool = sync.Pool{
 // 1. The caller function name (e.g. main.main() )
 // 2. The file path and line number (e.g. main.go:69)
 // 3. The PC offset from the function entry in hexadecimal
-func writeStack(buf *[]byte) {
+//
+// skip is the number of additional frames to skip, with 0 identifying the caller of Printf.
+// Leading frames of functions marked by Helper are skipped as well.
+func writeStack(buf *[]byte, skip int) {
 	// calldepth skips n frames to report the correct file and line number
 	// 0 = runtime -> extern.go
 	// 1 = writeStack -> trace.go
-	// 2 = Printf -> printf.go
-	// 3 = callerFn
-	const calldepth = 3
+	// 2 = printf -> printf.go
+	// 3 = Printf -> printf.go
+	// 4 = callerFn
+	const calldepth = 4
 
-	pcs := pcPool.Get().([]uintptr)
+	pcsp := pcPool.Get().(*[]uintptr)
+	defer pcPool.Put(pcsp)
 
-	n := runtime.Callers(calldepth, pcs)
+	n := runtime.Callers(calldepth+skip, *pcsp)
 	if n > maxFrames {
 		n = maxFrames
 	}
-	pcs = pcs[:n]
+	pcs := (*pcsp)[:n]
 
 	frames := runtime.CallersFrames(pcs)
+	helpers := hasHelpers.Load()
 	for {
 		frame, more := frames.Next()
 
+		if helpers && isHelper(frame.Function) && more {
+			continue
+		}
+		helpers = false
+
 		fnName := frame.Function
 		if isAtRuntimeCalldepth(fnName) {
 			// If we've reached go internal frames don't descend any deeper.
@@ -75,7 +92,6 @@ func writeStack(buf *[]byte) {
 		}
 	}
 
-	pcPool.Put(pcs[:cap(pcs)])
 }
 
 // isAtRuntimeCalldepth checks if a frame's function is at runtime level depth.
@@ -101,20 +117,206 @@ func appendHex(buf *[]byte, n uint64) {
 
 type caller struct {
 	key            []any
+	hkey           any
+	name           string
+	handle         bool
+	goscope        int
+	goid           uint64
+	policy         int
+	policyN        int64
+	calls          int64
+	sink           writeOutputFn
+	tee            bool
+	deadline       time.Duration
+	watchdog       *time.Timer
+	file           string
+	line           int
+	start          time.Time
 	id             string
 	pc             uintptr
+	depth          int
 	lpc            uintptr
 	runFuncForPC   uintptr
 	frameEntry     uintptr
 	frameFuncEntry uintptr
+	// Next older open region. Read without holding callersMu.
+	older atomic.Pointer[caller]
+	// Next newer open region. Guarded by callersMu.
+	newer *caller
+	// Whether the region is open. Guarded by callersMu.
+	open bool
 }
 
+// Open regions form a doubly linked list, newest first, so a region is added and removed in constant time
+// regardless of the number of open regions.
+// Readers walk the list from newestCaller via caller.older without locking; writers must hold callersMu.
 var (
 	callersMu    sync.RWMutex
-	callersStore atomic.Value
+	newestCaller atomic.Pointer[caller]
+	// Set of entry PCs of all open regions (map[uintptr]struct{}).
+	// Derived from the open regions and updated alongside them.
+	entriesStore atomic.Value
 	traceCount   int32
+	// Number of open regions bound to a goroutine
+	goroutineBoundCount int32
+	// Number of open regions with a name
+	namedCount int32
+	// Number of open regions with a stack trace policy
+	policyCount int32
+	// Number of open regions with their own output
+	sinkCount int32
+)
+
+// Goroutine scopes of a region
+const (
+	// Region applies to every goroutine
+	scopeAll = iota
+	// Region applies only to the goroutine that started it
+	scopeGoroutine
+	// Region applies to the goroutine that started it and goroutines spawned by it
+	scopeGoroutineTree
+)
+
+// Number of open regions per entry PC.
+// Guarded by callersMu.
+var entryCounts = make(map[uintptr]int)
+
+// linkRegion adds c as the newest open region.
+// callersMu must be held.
+func linkRegion(c *caller) {
+	if newest := newestCaller.Load(); newest != nil {
+		c.older.Store(newest)
+		newest.newer = c
+	}
+	c.open = true
+	newestCaller.Store(c)
+	storeEntries(c, nil)
+}
+
+// unlinkRegion removes the open region c.
+// c keeps pointing to the next older region so readers that already reached c continue past it.
+// callersMu must be held.
+func unlinkRegion(c *caller) {
+	older := c.older.Load()
+	if c.newer != nil {
+		c.newer.older.Store(older)
+	} else {
+		newestCaller.Store(older)
+	}
+	if older != nil {
+		older.newer = c.newer
+	}
+	c.newer = nil
+	c.open = false
+	storeEntries(nil, c)
+}
+
+// storeEntries updates the entry PC set of the open regions.
+// added and removed are the regions that got added or removed, if any.
+// The entry PC set is only rebuilt if an entry PC without an open region gets added or the last region of an entry PC is removed.
+// callersMu must be held.
+func storeEntries(added, removed *caller) {
+	changed := entriesStore.Load() == nil
+	if added != nil {
+		entryCounts[added.pc]++
+		changed = changed || entryCounts[added.pc] == 1
+	}
+	if removed != nil {
+		entryCounts[removed.pc]--
+		if entryCounts[removed.pc] == 0 {
+			delete(entryCounts, removed.pc)
+			changed = true
+		}
+	}
+
+	if changed {
+		entries := make(map[uintptr]struct{}, len(entryCounts))
+		for pc := range entryCounts {
+			entries[pc] = struct{}{}
+		}
+		entriesStore.Store(entries)
+	}
+}
+
+// countRegion adds delta to the counters tracking open regions with c's properties.
+func countRegion(c *caller, delta int32) {
+	atomic.AddInt32(&traceCount, delta)
+	if c.goscope != scopeAll {
+		atomic.AddInt32(&goroutineBoundCount, delta)
+	}
+	if c.name != "" {
+		atomic.AddInt32(&namedCount, delta)
+	}
+	if c.policy != policyDefault {
+		atomic.AddInt32(&policyCount, delta)
+	}
+	if c.sink != nil {
+		atomic.AddInt32(&sinkCount, delta)
+	}
+}
+
+// pcInfo holds everything tracingRegions needs to know about a return PC.
+type pcInfo struct {
+	// Entry PC of the function containing the PC
+	entry uintptr
+	// Whether the PC is inside a static region
+	static bool
+}
+
+// Cache of return PCs to their pcInfo.
+// Callsites are finite so the cache is bounded by the number of distinct callsites leading to Printf.
+var (
+	pcInfoMu    sync.RWMutex
+	pcInfoCache = make(map[uintptr]pcInfo, 64)
 )
 
+// infoForPC returns the pcInfo for the return PC pc, as returned by runtime.Callers.
+// The entry of inlined frames is the entry of the function they got inlined into, which equals runtime.Frame.Entry.
+//
+// runtime.FuncForPC allocates for inlined frames so results are cached.
+func infoForPC(pc uintptr) pcInfo {
+	pcInfoMu.RLock()
+	info, ok := pcInfoCache[pc]
+	pcInfoMu.RUnlock()
+	if ok {
+		return info
+	}
+
+	// pc is a return address; pc-1 is inside the call instruction.
+	if f := runtime.FuncForPC(pc - 1); f != nil {
+		info.entry = f.Entry()
+	}
+	if hasStaticRegions.Load() {
+		info.static = inStaticFrames(pc)
+	}
+
+	pcInfoMu.Lock()
+	pcInfoCache[pc] = info
+	pcInfoMu.Unlock()
+
+	return info
+}
+
+// callDepth returns the number of frames on the call stack, starting skip frames above callDepth.
+// Inlined calls don't have a frame of their own.
+func callDepth(skip int) int {
+	pcsp := pcPool.Get().(*[]uintptr)
+	defer pcPool.Put(pcsp)
+
+	n := runtime.Callers(skip+1, *pcsp)
+	if n < len(*pcsp) {
+		return n
+	}
+
+	// The stack is deeper than maxFrames, count the rest in chunks.
+	depth := n
+	for n == len(*pcsp) {
+		n = runtime.Callers(skip+1+depth, *pcsp)
+		depth += n
+	}
+	return depth
+}
+
 func deleteItemAt[T any](s []T, idx int) []T {
 	_ = s[idx]
 	res := make([]T, len(s)-1)
@@ -124,7 +326,7 @@ func deleteItemAt[T any](s []T, idx int) []T {
 }
 
 func StartTrace(v ...any) {
-	startTrace(2, v)
+	startTrace(2, v, "", false, nil)
 }
 
 // startTrace marks the current caller as a tracing region.
@@ -132,41 +334,76 @@ func StartTrace(v ...any) {
 // skip controls how many stack frames above startTrace to skip before capturing
 // the region entry in order to get the actual callsite.
 // key is an optional identifier which may later be used to stop the matching region via stopTrace.
+// name is an optional label for the region.
+// If handle is set the region can only be closed via endRegion.
+// opts are applied to the region before it gets stored.
 //
 // Internally the function records the caller's function identifier and entry PC,
-// appending a new entry to callersStore.
+// linking a new open region.
 //
-// On error this function fails silently.
-func startTrace(skip int, key []any) {
+// On error this function fails silently and returns nil.
+func startTrace(skip int, key []any, name string, handle bool, opts []RegionOption) *caller {
+	var hkey any
+	if len(key) > 0 {
+		var ok bool
+		if hkey, ok = regionKey(key); !ok {
+			invalidKey(skip+1, "StartTrace", key)
+			return nil
+		}
+	}
+
 	pc := make([]uintptr, 1)
 	n := runtime.Callers(skip+1, pc)
 	if n == 0 {
-		return
+		return nil
 	}
 
 	pc = pc[:n]
 	frames := runtime.CallersFrames(pc)
 
 	frame, _ := frames.Next()
-	if frame.Function == "" || frame.Func == nil {
+	if frame.Function == "" || frame.Entry == 0 {
 		// We cannot identify the function.
 		// This may happen in FFI.
-		return
+		// Inlined frames have no Func but their Entry is the one of the function they got inlined into,
+		// which is what tracingRegions compares against.
+		return nil
 	}
 
-	c := caller{key: key, id: frame.Function, pc: frame.Entry}
+	c := &caller{
+		key:    key,
+		hkey:   hkey,
+		name:   name,
+		handle: handle,
+		file:   frame.File,
+		line:   frame.Line,
+		start:  time.Now(),
+		id:     frame.Function,
+		pc:     frame.Entry,
+		depth:  callDepth(skip + 1),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	if c.goscope != scopeAll || c.deadline > 0 {
+		c.goid = currentGoroutine().id
+	}
 
 	callersMu.Lock()
 	defer callersMu.Unlock()
 
-	callers := callersStore.Load().([]caller)
+	startWatchdog(c)
+	linkRegion(c)
+	if len(key) > 0 {
+		addKeyedRegion(c)
+	}
 
-	newCallers := make([]caller, len(callers)+1)
-	copy(newCallers, callers)
-	newCallers[len(callers)] = c
-	callersStore.Store(newCallers)
+	countRegion(c, 1)
+	regionEntered(c)
 
-	atomic.AddInt32(&traceCount, 1)
+	return c
 }
 
 func StopTrace(v ...any) {
@@ -175,44 +412,44 @@ func StopTrace(v ...any) {
 
 // stopTrace closes a previously started tracing region.
 //
-// It closes the the most recent started region.
-// If key is non-nil, the most recent region whose key matches is closed.
+// It closes the the most recent region started by the same call of the calling function.
+// If key is non-empty, the most recent region whose key matches is closed.
 //
-// On success callersStore is updated.
+// On success the region is unlinked.
 // On error this function fails silently.
 func stopTrace(skip int, key []any) {
+	var hkey any
+	if len(key) > 0 {
+		var ok bool
+		if hkey, ok = regionKey(key); !ok {
+			invalidKey(skip+1, "StopTrace", key)
+			return
+		}
+	}
+
 	if tc := atomic.LoadInt32(&traceCount); tc == 0 {
-		// TODO: maybe panic here?
+		misuse(skip+1, "StopTrace%s called without any open region", formatKey(key))
 		return
 	}
 
-	var newCallers []caller
-
-	if key != nil {
-		// Check if we find a region with the matching key.
-		// If we don't find one return.
+	if len(key) > 0 {
+		// Keyed regions are looked up by their key.
 		callersMu.Lock()
 		defer callersMu.Unlock()
-		callers := callersStore.Load().([]caller)
-		for i := len(callers) - 1; i >= 0; i-- {
-			c := callers[i]
-
-			if reflect.DeepEqual(c.key, key) {
-				// Found it.
-				newCallers = deleteItemAt(callers, i)
-				callersStore.Store(newCallers)
-				atomic.AddInt32(&traceCount, -1)
-				return
-			}
+
+		if c := lastKeyedRegion(hkey); c != nil {
+			removeRegion(c)
+			return
 		}
 
-		// TODO: should this panic or fail silently?
+		misuse(skip+1, "StopTrace%s matches no open region", formatKey(key))
 		return
 	}
 
 	pc := make([]uintptr, 1)
 	n := runtime.Callers(skip+1, pc)
 	if n == 0 {
+		misuse(skip+1, "StopTrace called from an unidentifiable frame")
 		return
 	}
 
@@ -220,62 +457,187 @@ func stopTrace(skip int, key []any) {
 	frames := runtime.CallersFrames(pc)
 
 	frame, _ := frames.Next()
-	if frame.Function == "" || frame.Func == nil {
+	if frame.Function == "" || frame.Entry == 0 {
 		// We cannot identify the function.
 		// This may happen in FFI.
+		// Inlined frames have no Func but their Entry is the one of the function they got inlined into,
+		// which is what tracingRegions compares against.
+		misuse(skip+1, "StopTrace called from an unidentifiable frame")
 		return
 	}
 
+	depth := callDepth(skip + 1)
+
 	callersMu.Lock()
 	defer callersMu.Unlock()
-	callers := callersStore.Load().([]caller)
 
 	// Check if this frame has an open region.
-	for i := len(callers) - 1; i >= 0; i-- {
-		c := callers[i]
-		if c.id == frame.Function && c.pc == frame.Entry {
+	// The depth tells apart calls of the same function sharing an entry PC,
+	// e.g. levels of a recursion, generic instantiations of the same shape or a method called on different receivers.
+	// Regions started via BeginRegion are skipped; they are closed by their handle only.
+	for c := newestCaller.Load(); c != nil; c = c.older.Load() {
+		if !c.handle && c.id == frame.Function && c.pc == frame.Entry && c.depth == depth {
 			// Found it.
-			newCallers = deleteItemAt(callers, i)
-			callersStore.Store(newCallers)
-			atomic.AddInt32(&traceCount, -1)
+			removeRegion(c)
 			return
 		}
 	}
-	return
+
+	misuse(skip+1, "StopTrace called in %s which has no open region", frame.Function)
+}
+
+// removeRegion closes the open region c.
+// callersMu must be held.
+func removeRegion(c *caller) {
+	stopWatchdog(c)
+	unlinkRegion(c)
+	if len(c.key) > 0 {
+		removeKeyedRegion(c)
+	}
+
+	countRegion(c, -1)
+	regionExited(c)
 }
 
+// maxRegions is the number of regions printf looks up without allocating.
+// More deeply nested regions are still reported.
+const maxRegions = 8
+
 // inTracingRegion reports whether any frame in the current call stack is inside a tracked tracing region.
 func inTracingRegion(skip int) bool {
-	callers := callersStore.Load().([]caller)
-	if len(callers) == 0 {
-		return false
+	var buf [1]*caller
+	return len(tracingRegions(skip+1, buf[:0], 1)) > 0
+}
+
+// tracingRegions appends the open regions covering the current call stack to dst and returns the extended slice.
+// Regions are ordered from innermost to outermost.
+// At most limit regions are reported; the search stops as soon as dst holds limit regions.
+// A negative limit reports every region.
+//
+// Regions bound to a goroutine only match on the goroutine that started them.
+// Regions bound to a goroutine tree additionally match on every goroutine spawned by it, regardless of the call stack.
+func tracingRegions(skip int, dst []*caller, limit int) []*caller {
+	newest := newestCaller.Load()
+	if (newest == nil && !hasStaticRegions.Load()) || len(dst) == limit {
+		return dst
 	}
 
-	pcs := make([]uintptr, maxFrames)
-	n := runtime.Callers(skip+1, pcs[:])
-	if n == 0 {
-		return false
+	var g goroutineInfo
+	if atomic.LoadInt32(&goroutineBoundCount) > 0 {
+		g = currentGoroutine()
 	}
 
-	frames := runtime.CallersFrames(pcs[:n])
-	for i := 0; i < n; i++ {
-		frame, more := frames.Next()
-		if frame.Func == nil {
-			// We don't know which function we're in.
-			// This may happen in FFI
-			// TODO: should we just break here?
+	entries := entriesStore.Load().(map[uintptr]struct{})
+
+	pcsp := pcPool.Get().(*[]uintptr)
+	defer pcPool.Put(pcsp)
+
+	n := runtime.Callers(skip+1, *pcsp)
+	for _, pc := range (*pcsp)[:n] {
+		info := infoForPC(pc)
+		if info.static && !containsCaller(dst, staticRegion) {
+			dst = append(dst, staticRegion)
+			if len(dst) == limit {
+				return dst
+			}
+		}
+
+		entry := info.entry
+		if _, ok := entries[entry]; !ok {
 			continue
 		}
-		entry := frame.Entry
 
-		for j := len(callers) - 1; j >= 0; j-- {
-			if callers[j].pc == entry {
-				return true
+		for c := newest; c != nil; c = c.older.Load() {
+			if c.pc == entry && (c.goscope == scopeAll || c.goid == g.id) && !containsCaller(dst, c) {
+				dst = append(dst, c)
+				if len(dst) == limit {
+					return dst
+				}
 			}
 		}
-		if !more {
-			break
+	}
+
+	if g.n > 0 {
+		// Regions of ancestor goroutines enclose everything running on this goroutine.
+		for c := newest; c != nil; c = c.older.Load() {
+			if c.goscope == scopeGoroutineTree && g.descendsFrom(c.goid) {
+				dst = append(dst, c)
+				if len(dst) == limit {
+					return dst
+				}
+			}
+		}
+	}
+
+	return dst
+}
+
+func containsCaller(callers []*caller, c *caller) bool {
+	for _, cc := range callers {
+		if cc == c {
+			return true
 		}
 	}
 	return false
 }
+
+// Region is a handle to a single tracing region started by BeginRegion.
+type Region struct {
+	c *caller
+}
+
+func BeginRegion(name string, opts ...RegionOption) Region {
+	return Region{c: startTrace(2, nil, name, true, opts)}
+}
+
+func (r Region) End() {
+	endRegion(2, r.c)
+}
+
+// endRegion closes the tracing region identified by c.
+//
+// skip is the number of stack frames above endRegion to the caller of End.
+// Unlike stopTrace no lookup by key or scope is necessary as c identifies exactly one region.
+// Calling endRegion on an already closed region is a no-op.
+func endRegion(skip int, c *caller) {
+	if c == nil {
+		return
+	}
+
+	callersMu.Lock()
+	defer callersMu.Unlock()
+
+	if c.open {
+		removeRegion(c)
+		return
+	}
+
+	misuse(skip+1, "End called on region %s which was already closed", formatRegion(c))
+}
+
+// RegionOption configures a region started by BeginRegion.
+type RegionOption func(*caller)
+
+func BindGoroutine() RegionOption {
+	return func(c *caller) {
+		c.goscope = scopeGoroutine
+	}
+}
+
+func BindGoroutineTree() RegionOption {
+	return func(c *caller) {
+		c.goscope = scopeGoroutineTree
+	}
+}
+
+// traceContextKey is the context key under which WithTrace marks a context as traced.
+type traceContextKey struct{}
+
+func WithTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, true)
+}
+
+// inContextRegion reports whether ctx carries a tracing region started by WithTrace.
+func inContextRegion(ctx context.Context) bool {
+	return ctx != nil && ctx.Value(traceContextKey{}) != nil
+}
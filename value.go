@@ -0,0 +1,17 @@
+//go:build dlg
+
+package dlg
+
+func Value[T any](v T) T {
+	if expr := callExpr(1, "Value"); expr != "" {
+		printf(0, nil, "%s = %+v", []any{expr, v})
+	} else {
+		printf(0, nil, "%+v", []any{v})
+	}
+	return v
+}
+
+func LabeledValue[T any](label string, v T) T {
+	printf(0, nil, "%s = %+v", []any{label, v})
+	return v
+}
@@ -0,0 +1,114 @@
+//go:build dlg
+
+package dlg
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+func BeginRegionTimeout(name string, d time.Duration, opts ...RegionOption) Region {
+	opts = append(opts[:len(opts):len(opts)], withDeadline(d))
+	return Region{c: startTrace(2, nil, name, true, opts)}
+}
+
+// withDeadline sets up a watchdog reporting the region if it is still open after d.
+func withDeadline(d time.Duration) RegionOption {
+	return func(c *caller) {
+		c.deadline = d
+	}
+}
+
+// startWatchdog arms the watchdog of region c.
+// The goroutine c.goid is considered the owner of the region.
+func startWatchdog(c *caller) {
+	if c.deadline <= 0 {
+		return
+	}
+
+	c.watchdog = time.AfterFunc(c.deadline, func() {
+		regionOverdue(c)
+	})
+}
+
+// stopWatchdog disarms the watchdog of region c, if any.
+func stopWatchdog(c *caller) {
+	if c.watchdog != nil {
+		c.watchdog.Stop()
+	}
+}
+
+// regionOverdue writes a warning that region c exceeded its deadline, followed by the stack of the goroutine owning it e.g.
+//
+//	12:00:01 [52ms] region "flush" exceeded its deadline of 50ms
+//	  started at flush.go:12 in main.flush
+//	goroutine 7 [chan receive]:
+//	main.flush()
+//		/src/flush.go:15 +0x2c
+//	...
+//
+// Nothing is written if the region has been closed in the meantime.
+// The warning is written while holding callersMu so a region can't be closed between the check and the write.
+func regionOverdue(c *caller) {
+	callersMu.RLock()
+	defer callersMu.RUnlock()
+	if !c.open {
+		return
+	}
+
+	b := bufPool.Get().([]byte)
+
+	timestamp(&b)
+	b = append(b, "region "...)
+	b = appendRegionName(b, c)
+	b = append(b, "exceeded its deadline of "...)
+	b = append(b, c.deadline.String()...)
+	b = append(b, "\n  started at "...)
+	b = append(b, baseName(c.file)...)
+	b = append(b, ':')
+	pad(&b, c.line, -1)
+	b = append(b, " in "...)
+	b = append(b, c.id...)
+	b = append(b, '\n')
+
+	if stack := goroutineStack(c.goid); stack != nil {
+		b = append(b, stack...)
+		b = append(b, '\n')
+	} else {
+		b = append(b, "goroutine "...)
+		b = strconv.AppendUint(b, c.goid, 10)
+		b = append(b, " has exited\n"...)
+	}
+
+	writeEvent(b)
+}
+
+// goroutineStack returns the stack of the goroutine with the given id as formatted by runtime.Stack.
+// It returns nil if there's no such goroutine.
+func goroutineStack(id uint64) []byte {
+	buf := make([]byte, 1<<16)
+	n := runtime.Stack(buf, true)
+	for n == len(buf) && len(buf) < (1<<26) {
+		buf = make([]byte, len(buf)*2)
+		n = runtime.Stack(buf, true)
+	}
+	stacks := buf[:n]
+
+	// Stacks of different goroutines are separated by an empty line.
+	for len(stacks) > 0 {
+		stack := stacks
+		if i := bytes.Index(stacks, []byte("\n\n")); i >= 0 {
+			stack, stacks = stacks[:i+1], stacks[i+2:]
+		} else {
+			stacks = nil
+		}
+
+		if gid, ok := parseGoroutineID(stack, "goroutine "); ok && gid == id {
+			return bytes.TrimRight(stack, "\n")
+		}
+	}
+
+	return nil
+}